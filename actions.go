@@ -0,0 +1,392 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// actionFile is the file a `uses` directory must contain.
+const actionFile = "action.yaml"
+
+// resolveUsesPaths makes the relative `uses` paths of every step declared in
+// p absolute, relative to dir (the directory of the file declaring them), so
+// steps coming from included files and templates keep pointing at the right
+// action.
+func resolveUsesPaths(p *PipelineFile, dir string) {
+	for _, jobs := range [][]Job{p.Pipeline.Jobs, p.Pipeline.Finally} {
+		for i := range jobs {
+			resolveStepUses(jobs[i].Steps, dir)
+			resolveStepUses(jobs[i].Post, dir)
+		}
+	}
+	if p.Pipeline.OnFailure != nil {
+		resolveStepUses(p.Pipeline.OnFailure.Steps, dir)
+	}
+	for _, j := range p.Templates.Jobs {
+		resolveStepUses(j.Steps, dir)
+		resolveStepUses(j.Post, dir)
+	}
+	for name, s := range p.Templates.Steps {
+		if s.Uses != "" && !filepath.IsAbs(s.Uses) {
+			s.Uses = filepath.Join(dir, s.Uses)
+			p.Templates.Steps[name] = s
+		}
+	}
+}
+
+func resolveStepUses(steps []Step, dir string) {
+	for i := range steps {
+		if u := steps[i].Uses; u != "" && !filepath.IsAbs(u) {
+			steps[i].Uses = filepath.Join(dir, u)
+		}
+	}
+}
+
+// expandActions replaces every `uses` step (in jobs, post steps, finally
+// jobs and on_failure) with the steps of its action. It runs after
+// expandTemplates, so templates may contain `uses` steps.
+func expandActions(p *PipelineFile) error {
+	e := &actionExpander{actions: map[string]*Action{}}
+	for _, jobs := range [][]Job{p.Pipeline.Jobs, p.Pipeline.Finally} {
+		for i := range jobs {
+			j := &jobs[i]
+			var err error
+			if j.Steps, err = e.stepList(j.Steps, nil); err != nil {
+				return fmt.Errorf("job %s: %v", j.Name, err)
+			}
+			if j.Post, err = e.stepList(j.Post, nil); err != nil {
+				return fmt.Errorf("job %s post: %v", j.Name, err)
+			}
+		}
+	}
+	if of := p.Pipeline.OnFailure; of != nil {
+		steps, err := e.stepList(of.Steps, nil)
+		if err != nil {
+			return fmt.Errorf("on_failure: %v", err)
+		}
+		of.Steps = steps
+	}
+	return nil
+}
+
+// actionExpander loads each action directory once and detects actions
+// using themselves.
+type actionExpander struct {
+	actions map[string]*Action
+}
+
+// stepList returns steps with `uses` steps expanded. A list without any is
+// returned as is; otherwise a new slice is built, so step slices shared
+// between jobs (via templates) are not modified.
+func (e *actionExpander) stepList(steps []Step, stack []string) ([]Step, error) {
+	hasUses := false
+	for _, s := range steps {
+		if s.Uses != "" {
+			hasUses = true
+			break
+		}
+	}
+	if !hasUses {
+		return steps, nil
+	}
+	var out []Step
+	first := map[string]string{} // `uses` step name -> its first expanded step
+	for _, s := range steps {
+		if s.Uses == "" {
+			out = append(out, s)
+			continue
+		}
+		expanded, err := e.use(s, stack)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %v", s.Name, err)
+		}
+		first[s.Name] = expanded[0].Name
+		out = append(out, expanded...)
+	}
+	renameUsesTargets(out, first)
+	return out, nil
+}
+
+// load reads and validates the action in dir.
+func (e *actionExpander) load(dir string) (*Action, error) {
+	if a, ok := e.actions[dir]; ok {
+		return a, nil
+	}
+	path := filepath.Join(dir, actionFile)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var a Action
+	if err := yaml.Unmarshal(b, &a); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := validateParamDefs(a.Inputs); err != nil {
+		return nil, fmt.Errorf("%s: inputs: %v", path, err)
+	}
+	if len(a.Steps) == 0 {
+		return nil, fmt.Errorf("%s: action has no steps", path)
+	}
+	seen := map[string]bool{}
+	for _, s := range a.Steps {
+		if s.Name == "" || seen[s.Name] {
+			return nil, fmt.Errorf("%s: every step needs a unique name", path)
+		}
+		seen[s.Name] = true
+	}
+	resolveStepUses(a.Steps, dir)
+	e.actions[dir] = &a
+	return &a, nil
+}
+
+// inputCheck is an action input whose `with` value has placeholders. Its
+// type is checked once the value is known, before the action's first step
+// runs.
+type inputCheck struct {
+	use   string // name of the `uses` step
+	input Param
+	value string
+}
+
+// check interpolates the value and checks it against the input's type.
+func (c inputCheck) check(vars map[string]string) error {
+	if _, err := c.input.check(interpolate(c.value, vars)); err != nil {
+		return fmt.Errorf("step %s: input %s: %v", c.use, c.input.Name, err)
+	}
+	return nil
+}
+
+// actionInputs returns the input values for a use of a: the `with` values,
+// then the defaults. Values without placeholders are checked against the
+// input's type; values with placeholders are only known at runtime and are
+// returned as checks for then.
+func actionInputs(a *Action, with map[string]string) (map[string]string, []inputCheck, error) {
+	declared := map[string]Param{}
+	for _, in := range a.Inputs {
+		declared[in.Name] = in
+	}
+	keys := make([]string, 0, len(with))
+	for k := range with {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, ok := declared[k]; !ok {
+			return nil, nil, fmt.Errorf("unknown input '%s' in with", k)
+		}
+	}
+	inputs := map[string]string{}
+	var checks []inputCheck
+	for _, in := range a.Inputs {
+		v, ok := with[in.Name]
+		switch {
+		case ok && !strings.Contains(v, "{{"):
+			norm, err := in.check(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("input %s: %v", in.Name, err)
+			}
+			v = norm
+		case ok:
+			checks = append(checks, inputCheck{input: in, value: v})
+		case in.Default != nil:
+			v = *in.Default
+		case in.Required:
+			return nil, nil, fmt.Errorf("missing required input %s", in.Name)
+		}
+		inputs[in.Name] = v
+	}
+	return inputs, checks, nil
+}
+
+// actionStepFields are the Step fields use rewrites itself rather than
+// through placeholder substitution.
+var actionStepFields = map[string]bool{"Name": true, "Uses": true, "SaveOutput": true}
+
+// use expands the `uses` step s into the steps of its action:
+//   - step names become "<s.Name>/<name>", and goto targets naming steps of
+//     the action are renamed alike (to the first step of a nested `uses`)
+//   - {{inputs.NAME}} placeholders are replaced by the input values
+//   - the action's save_output variables become "<s.Name>.<var>", so they
+//     don't clash with pipeline variables or other uses of the action
+//   - the outputs are set as {{<s.Name>.outputs.<key>}} after the last step
+func (e *actionExpander) use(s Step, stack []string) ([]Step, error) {
+	if s.Name == "" {
+		return nil, fmt.Errorf("a step with uses needs a name")
+	}
+	if f := extraUsesField(s); f != "" {
+		return nil, fmt.Errorf("uses can't be combined with %s", f)
+	}
+	for _, d := range stack {
+		if d == s.Uses {
+			return nil, fmt.Errorf("action cycle: %s", strings.Join(append(stack, s.Uses), " -> "))
+		}
+	}
+	stack = append(stack, s.Uses)
+	a, err := e.load(s.Uses)
+	if err != nil {
+		return nil, err
+	}
+	inputs, checks, err := actionInputs(a, s.With)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.Uses, err)
+	}
+
+	scope := s.Name
+	steps := map[string]bool{}  // the action's step names
+	locals := map[string]bool{} // its save_output variables
+	nested := map[string]bool{} // its own `uses` steps
+	for _, st := range a.Steps {
+		steps[st.Name] = true
+		if st.SaveOutput != "" {
+			locals[st.SaveOutput] = true
+		}
+		if st.Uses != "" {
+			nested[st.Name] = true
+		}
+	}
+	var unknown []string
+	lookup := func(name string) (string, bool) {
+		if in, ok := strings.CutPrefix(name, "inputs."); ok {
+			v, ok := inputs[in]
+			if !ok {
+				unknown = append(unknown, in)
+			}
+			return v, ok
+		}
+		if locals[name] {
+			return "{{" + scope + "." + name + "}}", true
+		}
+		if n, _, ok := strings.Cut(name, ".outputs."); ok && nested[n] {
+			return "{{" + scope + "/" + name + "}}", true
+		}
+		return "", false
+	}
+	rewrite := func(str string) string { return rewritePlaceholders(str, lookup) }
+	target := func(name string) string {
+		if steps[name] {
+			return scope + "/" + name
+		}
+		return name
+	}
+
+	var out []Step
+	first := map[string]string{}
+	for _, st := range a.Steps {
+		rewriteFields(reflect.ValueOf(&st).Elem(), actionStepFields, rewrite)
+		st.Name = scope + "/" + st.Name
+		if st.SaveOutput != "" {
+			st.SaveOutput = scope + "." + st.SaveOutput
+		}
+		renameStepTargets(&st, target)
+		if st.Uses == "" {
+			out = append(out, st)
+			continue
+		}
+		sub, err := e.use(st, stack)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %v", st.Name, err)
+		}
+		first[st.Name] = sub[0].Name
+		out = append(out, sub...)
+	}
+	renameUsesTargets(out, first)
+
+	for _, c := range checks {
+		c.use = s.Name
+		out[0].inputChecks = append(out[0].inputChecks, c)
+	}
+
+	last := &out[len(out)-1]
+	exports := map[string]string{}
+	for k, v := range last.exports {
+		exports[k] = v
+	}
+	for k, v := range a.Outputs {
+		exports[scope+".outputs."+k] = rewrite(v)
+	}
+	last.exports = exports
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%s: unknown input '%s'", filepath.Join(s.Uses, actionFile), unknown[0])
+	}
+	return out, nil
+}
+
+// usesStepFields are the fields a `uses` step may set.
+var usesStepFields = map[string]bool{"Name": true, "Extends": true, "Uses": true, "With": true}
+
+// extraUsesField returns the YAML name of the first other field set on the
+// `uses` step s, or "". The step is replaced by the action's steps, so such
+// a field would otherwise be dropped silently.
+func extraUsesField(s Step) string {
+	v := reflect.ValueOf(s)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || usesStepFields[f.Name] || v.Field(i).IsZero() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		return name
+	}
+	return ""
+}
+
+// renameUsesTargets points the goto targets of steps naming a `uses` step
+// at the first step it expanded to, so e.g. a retry loop can jump back to
+// an action.
+func renameUsesTargets(steps []Step, first map[string]string) {
+	if len(first) == 0 {
+		return
+	}
+	rename := func(name string) string {
+		if f, ok := first[name]; ok {
+			return f
+		}
+		return name
+	}
+	for i := range steps {
+		renameStepTargets(&steps[i], rename)
+	}
+}
+
+// renameStepTargets applies rename to every goto step target of s. The
+// conditions and when slices are copied, as they may be shared with other
+// steps (via templates).
+func renameStepTargets(s *Step, rename func(string) string) {
+	if s.ElseStep != "" {
+		s.ElseStep = rename(s.ElseStep)
+	}
+	if s.OnTimeoutStep != "" {
+		s.OnTimeoutStep = rename(s.OnTimeoutStep)
+	}
+	if len(s.Conditions) > 0 {
+		s.Conditions = append([]Condition(nil), s.Conditions...)
+	}
+	for i := range s.Conditions {
+		if s.Conditions[i].Step != "" {
+			s.Conditions[i].Step = rename(s.Conditions[i].Step)
+		}
+	}
+	s.When = renameWhenTargets(s.When, rename)
+}
+
+func renameWhenTargets(entries []WhenEntry, rename func(string) string) []WhenEntry {
+	if len(entries) == 0 {
+		return entries
+	}
+	entries = append([]WhenEntry(nil), entries...)
+	for i := range entries {
+		if entries[i].Step != "" {
+			entries[i].Step = rename(entries[i].Step)
+		}
+		entries[i].All = renameWhenTargets(entries[i].All, rename)
+		entries[i].Any = renameWhenTargets(entries[i].Any, rename)
+	}
+	return entries
+}
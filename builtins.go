@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// builtinVarNames lists the runtime variables pipejob defines. They are
+// available as {{NAME}} and exported to every command's environment.
+var builtinVarNames = []string{
+	"PIPEJOB_RUN_ID",
+	"PIPELINE_NAME",
+	"JOB_NAME",
+	"STEP_NAME",
+	"RUN_DIR",
+	"START_TIME",
+	"YAML_DIR",
+	"GIT_SHA",
+}
+
+// runBuiltins returns the run-scoped built-in variables. JOB_NAME and
+// STEP_NAME are set per step by the runner.
+func runBuiltins(pipelineName, yamlPath, runID, runDir string, start time.Time) map[string]string {
+	yamlDir, err := filepath.Abs(filepath.Dir(yamlPath))
+	if err != nil {
+		yamlDir = filepath.Dir(yamlPath)
+	}
+	if abs, err := filepath.Abs(runDir); err == nil {
+		runDir = abs
+	}
+	return map[string]string{
+		"PIPEJOB_RUN_ID": runID,
+		"PIPELINE_NAME":  pipelineName,
+		"RUN_DIR":        runDir,
+		"START_TIME":     start.Format(time.RFC3339),
+		"YAML_DIR":       yamlDir,
+		"GIT_SHA":        gitSHA(yamlDir),
+	}
+}
+
+// newRunID returns an id unique to this run: the start timestamp plus a
+// random suffix, e.g. 20251104-072132-9f3a1c.
+func newRunID(start time.Time) string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return start.Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// gitSHA returns the commit checked out in dir, or "" outside a git
+// repository (or without git installed).
+func gitSHA(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// builtinEnv returns the built-in variables as KEY=VALUE pairs for a
+// command's environment, using their current values.
+func builtinEnv(vars map[string]string) []string {
+	env := make([]string, 0, len(builtinVarNames))
+	for _, n := range builtinVarNames {
+		env = append(env, n+"="+vars[n])
+	}
+	return env
+}
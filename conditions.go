@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// patternMatcher is a `conditions` pattern or `when` regex compiled at load
+// time. Patterns without `{{VAR}}` placeholders are compiled once; patterns
+// with placeholders are compiled when evaluated and cached per interpolated
+// value, so goto-driven retry loops don't recompile them.
+type patternMatcher struct {
+	pattern string
+	re      *regexp.Regexp            // set for static patterns
+	cache   map[string]*regexp.Regexp // interpolated pattern -> regex
+}
+
+// newPatternMatcher compiles a static pattern right away so syntax errors
+// are reported before any command runs.
+func newPatternMatcher(pattern string) (*patternMatcher, error) {
+	m := &patternMatcher{pattern: pattern}
+	if strings.Contains(pattern, "{{") {
+		m.cache = map[string]*regexp.Regexp{}
+		return m, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	m.re = re
+	return m, nil
+}
+
+// match reports whether s matches the pattern after interpolating vars.
+func (m *patternMatcher) match(s string, vars map[string]string) (bool, error) {
+	if m.re != nil {
+		return m.re.MatchString(s), nil
+	}
+	pat := interpolate(m.pattern, vars)
+	re, ok := m.cache[pat]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(pat); err != nil {
+			return false, fmt.Errorf("invalid regex '%s': %v", pat, err)
+		}
+		m.cache[pat] = re
+	}
+	return re.MatchString(s), nil
+}
+
+// compileConditions builds the pattern matchers of every step's
+// `conditions` and `when` tree. Jobs share their step slices with the
+// execution queue, so the matchers are set in place.
+func compileConditions(jobs []Job) error {
+	for ji := range jobs {
+		for si := range jobs[ji].Steps {
+			step := &jobs[ji].Steps[si]
+			for ci := range step.Conditions {
+				c := &step.Conditions[ci]
+				m, err := newPatternMatcher(c.Pattern)
+				if err != nil {
+					return fmt.Errorf("invalid condition regex '%s' in job %s step %s: %v", c.Pattern, jobs[ji].Name, step.Name, err)
+				}
+				c.matcher = m
+			}
+			for wi := range step.When {
+				if err := compileWhenEntry(&step.When[wi]); err != nil {
+					return fmt.Errorf("invalid when entry in job %s step %s: %v", jobs[ji].Name, step.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// compileWhenEntry compiles the regex leaves of a `when` tree.
+func compileWhenEntry(w *WhenEntry) error {
+	for i := range w.All {
+		if err := compileWhenEntry(&w.All[i]); err != nil {
+			return err
+		}
+	}
+	for i := range w.Any {
+		if err := compileWhenEntry(&w.Any[i]); err != nil {
+			return err
+		}
+	}
+	if w.Regex != "" {
+		m, err := newPatternMatcher(w.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex '%s': %v", w.Regex, err)
+		}
+		w.matcher = m
+	}
+	return nil
+}
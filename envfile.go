@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parseEnvFile reads a dotenv file. See parseEnv for the accepted syntax.
+// A missing file is returned as the *PathError from os.ReadFile so callers
+// can ignore it with os.IsNotExist.
+func parseEnvFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := parseEnv(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", path, err)
+	}
+	return vars, nil
+}
+
+// envLineError is a parse error at a 1-based line of a dotenv file.
+type envLineError struct {
+	Line int
+	Msg  string
+}
+
+func (e *envLineError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Line, e.Msg)
+}
+
+// parseEnv parses dotenv content:
+//   - blank lines and lines starting with # are skipped
+//   - an optional `export ` prefix is allowed
+//   - unquoted values are trimmed and end at an inline ` #` comment
+//   - 'single quoted' values are literal
+//   - "double quoted" values support \n, \r, \t, \", \\ and \$ escapes
+//   - quoted values may span several lines
+//   - ${VAR}, ${VAR:-default} and $VAR are expanded in unquoted and double
+//     quoted values, from keys defined earlier in the file or the process
+//     environment
+//
+// Malformed lines are reported as *envLineError.
+func parseEnv(src string) (map[string]string, error) {
+	p := &envParser{src: strings.ReplaceAll(src, "\r\n", "\n"), line: 1, vars: map[string]string{}}
+	for {
+		p.skipBlankAndComments()
+		if p.eof() {
+			return p.vars, nil
+		}
+		if err := p.parseAssignment(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type envParser struct {
+	src  string
+	pos  int
+	line int
+	vars map[string]string
+}
+
+func (p *envParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *envParser) errorf(line int, format string, args ...interface{}) error {
+	return &envLineError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next consumes one byte, keeping the line count.
+func (p *envParser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *envParser) skipSpaces() {
+	for !p.eof() && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *envParser) skipBlankAndComments() {
+	for !p.eof() {
+		p.skipSpaces()
+		if p.eof() {
+			return
+		}
+		switch p.src[p.pos] {
+		case '\n':
+			p.next()
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *envParser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+// restOfLine consumes and returns the remainder of the current line.
+func (p *envParser) restOfLine() string {
+	start := p.pos
+	for !p.eof() && p.src[p.pos] != '\n' {
+		p.pos++
+	}
+	s := p.src[start:p.pos]
+	if !p.eof() {
+		p.next()
+	}
+	return s
+}
+
+func isEnvKeyChar(c byte, first bool) bool {
+	switch {
+	case c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z'):
+		return true
+	case !first && ((c >= '0' && c <= '9') || c == '.'):
+		return true
+	}
+	return false
+}
+
+func (p *envParser) parseKey() string {
+	start := p.pos
+	for !p.eof() && isEnvKeyChar(p.src[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *envParser) parseAssignment() error {
+	line := p.line
+	key := p.parseKey()
+	if key == "export" && !p.eof() && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.skipSpaces()
+		key = p.parseKey()
+	}
+	if key == "" {
+		return p.errorf(line, "expected KEY=VALUE, got %q", strings.TrimSpace(p.restOfLine()))
+	}
+	p.skipSpaces()
+	if p.eof() || p.src[p.pos] != '=' {
+		return p.errorf(line, "missing '=' after %s", key)
+	}
+	p.pos++
+	p.skipSpaces()
+
+	var val string
+	if !p.eof() && (p.src[p.pos] == '\'' || p.src[p.pos] == '"') {
+		quote := p.next()
+		v, err := p.parseQuoted(quote, line)
+		if err != nil {
+			return err
+		}
+		// only a comment may follow the closing quote
+		rest := strings.TrimSpace(p.restOfLine())
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return p.errorf(line, "unexpected %q after quoted value of %s", rest, key)
+		}
+		val = v
+	} else {
+		raw := p.restOfLine()
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = raw[:i]
+		} else if i := strings.Index(raw, "\t#"); i >= 0 {
+			raw = raw[:i]
+		}
+		v, err := p.expand(strings.TrimSpace(raw), line, false)
+		if err != nil {
+			return err
+		}
+		val = v
+	}
+	p.vars[key] = val
+	return nil
+}
+
+// parseQuoted reads up to the closing quote. Single quotes are literal;
+// double quotes process escapes and expansions.
+func (p *envParser) parseQuoted(quote byte, line int) (string, error) {
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf(line, "unterminated %c-quoted value", quote)
+		}
+		c := p.next()
+		if c == quote {
+			break
+		}
+		if quote == '"' && c == '\\' && !p.eof() {
+			e := p.next()
+			switch e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case '"', '\\':
+				sb.WriteByte(e)
+			case '$':
+				// marked so expansion below keeps it literal, unlike a `$`
+				// after an escaped backslash (`\\$HOME`)
+				sb.WriteByte(escapedDollar)
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(e)
+			}
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	if quote == '\'' {
+		return sb.String(), nil
+	}
+	return p.expand(sb.String(), line, true)
+}
+
+// escapedDollar stands for a `\$` of a double-quoted value until expansion.
+const escapedDollar = '\x00'
+
+// expand replaces ${VAR}, ${VAR:-default} and $VAR references. An escaped
+// \$ yields a literal $; in double-quoted values it was already replaced by
+// escapedDollar, so a backslash before `$` is literal there.
+func (p *envParser) expand(s string, line int, quoted bool) (string, error) {
+	if !strings.Contains(s, "$") && !(quoted && strings.ContainsRune(s, escapedDollar)) {
+		return s, nil
+	}
+	lookup := func(name string) string {
+		if v, ok := p.vars[name]; ok {
+			return v
+		}
+		return os.Getenv(name)
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quoted && c == escapedDollar {
+			sb.WriteByte('$')
+			continue
+		}
+		if !quoted && c == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			sb.WriteByte('$')
+			i++
+			continue
+		}
+		if c != '$' || i+1 >= len(s) {
+			sb.WriteByte(c)
+			continue
+		}
+		if s[i+1] == '{' {
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", p.errorf(line, "unterminated ${ reference")
+			}
+			ref := s[i+2 : i+2+end]
+			name, def, hasDef := strings.Cut(ref, ":-")
+			v := lookup(name)
+			if v == "" && hasDef {
+				v = def
+			}
+			sb.WriteString(v)
+			i += 2 + end
+			continue
+		}
+		j := i + 1
+		for j < len(s) && isEnvKeyChar(s[j], j == i+1) && s[j] != '.' {
+			j++
+		}
+		if j == i+1 {
+			// a lone $ is literal
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteString(lookup(s[i+1 : j]))
+		i = j - 1
+	}
+	return sb.String(), nil
+}
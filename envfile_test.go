@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	t.Setenv("PIPEJOB_TEST_HOME", "/home/ci")
+	src := `# comment
+export REGION=eu-west-1
+PLAIN = value with spaces   # inline comment
+HASH=abc#def
+SINGLE='literal $REGION \n'
+DOUBLE="tab\there \"quoted\" \$5"
+BACKSLASH="x\\$REGION"
+BACKSLASH_ESC="x\\\$REGION"
+MULTI="line one
+line two"
+REF=${REGION}-bucket
+BARE=$REGION/x
+DEFAULT=${MISSING:-fallback}
+FROM_ENV=${PIPEJOB_TEST_HOME}/cache
+EMPTY=
+`
+	vars, err := parseEnv(src)
+	if err != nil {
+		t.Fatalf("parseEnv: %v", err)
+	}
+	want := map[string]string{
+		"REGION":        "eu-west-1",
+		"PLAIN":         "value with spaces",
+		"HASH":          "abc#def",
+		"SINGLE":        `literal $REGION \n`,
+		"DOUBLE":        "tab\there \"quoted\" $5",
+		"BACKSLASH":     `x\eu-west-1`,
+		"BACKSLASH_ESC": `x\$REGION`,
+		"MULTI":         "line one\nline two",
+		"REF":           "eu-west-1-bucket",
+		"BARE":          "eu-west-1/x",
+		"DEFAULT":       "fallback",
+		"FROM_ENV":      "/home/ci/cache",
+		"EMPTY":         "",
+	}
+	for k, v := range want {
+		if got, ok := vars[k]; !ok || got != v {
+			t.Errorf("%s: got %q, want %q", k, got, v)
+		}
+	}
+	if len(vars) != len(want) {
+		t.Errorf("got %d keys, want %d: %v", len(vars), len(want), vars)
+	}
+}
+
+func TestParseEnvErrors(t *testing.T) {
+	cases := map[string]string{
+		"A=1\nNOT AN ASSIGNMENT\n":   "2: missing '='",
+		"A=1\nB=\"open\nC=3\n":       "2: unterminated \"-quoted value",
+		"A='x' trailing\n":           "1: unexpected",
+		"\n\n=novalue\n":             "3: expected KEY=VALUE",
+		"A=${UNCLOSED\n":             "1: unterminated ${",
+		"A=1\r\nB=2\r\nbad line\r\n": "3: missing '='",
+	}
+	for src, want := range cases {
+		_, err := parseEnv(src)
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("parseEnv(%q): got error %v, want prefix %q", src, err, want)
+		}
+	}
+}
+
+func TestInvalidEnvFileStopsRun(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: envfile
+  jobs:
+    - name: j1
+      steps:
+        - name: s1
+          type: command
+          command: echo "RAN"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	envPath := filepath.Join(tmp, "bad.env")
+	if err := os.WriteFile(envPath, []byte("OK=1\nbroken\n"), 0644); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath, "--env-file", envPath})
+	})
+	if rc != 2 || strings.Contains(out, "RAN") {
+		t.Fatalf("expected exit code 2 before any command, got %d: %s", rc, out)
+	}
+	// a missing --env-file is an error, a missing default .env is not
+	out = captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath, "--env-file", filepath.Join(tmp, "missing.env")})
+	})
+	if rc != 2 || strings.Contains(out, "RAN") {
+		t.Fatalf("expected exit code 2 for a missing --env-file, got %d: %s", rc, out)
+	}
+	if _, err := os.Stat(".env"); os.IsNotExist(err) {
+		captureStdout(func() {
+			rc = RunWithArgs([]string{yamlPath})
+		})
+		if rc != 0 {
+			t.Fatalf("expected a missing default .env to be ignored, got %d", rc)
+		}
+	}
+}
@@ -1,16 +1,66 @@
 package main
 
 import (
-	"context"
+	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
+// activeProcess tracks the command currently started by runLocalCommandExec
+// so signals received by pipejob can be forwarded to its process group.
+var activeProcess struct {
+	sync.Mutex
+	pid int
+}
+
+func setActiveProcess(pid int) {
+	activeProcess.Lock()
+	activeProcess.pid = pid
+	activeProcess.Unlock()
+}
+
+// signalActiveProcess sends sig to the process group of the running command
+// and returns its pid, or 0 when no command is running.
+func signalActiveProcess(sig syscall.Signal) int {
+	activeProcess.Lock()
+	defer activeProcess.Unlock()
+	if activeProcess.pid != 0 {
+		killProcessGroup(activeProcess.pid, sig)
+	}
+	return activeProcess.pid
+}
+
+// signalProcessIfActive sends sig to the process group of pid, but only if
+// pid is still the running command (so a later command is never hit).
+func signalProcessIfActive(pid int, sig syscall.Signal) {
+	activeProcess.Lock()
+	defer activeProcess.Unlock()
+	if pid != 0 && activeProcess.pid == pid {
+		killProcessGroup(pid, sig)
+	}
+}
+
+// killProcessGroup delivers sig to the process group led by pid. On Windows
+// only a forced kill of the process tree (taskkill) is possible, so any
+// signal other than SIGKILL is ignored there.
+func killProcessGroup(pid int, sig syscall.Signal) {
+	if runtime.GOOS != "windows" {
+		// negative pid indicates pgid
+		_ = syscall.Kill(-pid, sig)
+		return
+	}
+	if sig == syscall.SIGKILL {
+		_ = exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+	}
+}
+
 // resolveJobIndex looks for `target` in the current execJobs slice. If not
 // found, it searches the full list of declared jobs `allJobs`. If the target
 // exists in `allJobs` but not in `execJobs`, it inserts the job immediately
@@ -41,12 +91,166 @@ func resolveJobIndexExec(execJobs *[]Job, allJobs []Job, target string, insertAf
 	return -1, false
 }
 
+// insertCallJob inserts a copy of the declared job `target` immediately
+// after index `after` so it runs as a subroutine of the calling job,
+// regardless of where (or whether) the target appears in execJobs. Returns
+// (index, true) on success, (-1, false) if no such job is declared.
+func insertCallJob(execJobs *[]Job, allJobs []Job, target string, after int) (int, bool) {
+	for _, j := range allJobs {
+		if j.Name == target {
+			pos := after + 1
+			if pos > len(*execJobs) {
+				pos = len(*execJobs)
+			}
+			*execJobs = append((*execJobs)[:pos], append([]Job{j}, (*execJobs)[pos:]...)...)
+			return pos, true
+		}
+	}
+	return -1, false
+}
+
+// stepIndexOf returns the index of the step named `name`, or -1.
+func stepIndexOf(steps []Step, name string) int {
+	for i := range steps {
+		if steps[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// buildExecOrder returns the initial execution queue. Jobs named in
+// `selected` (the --job flag) run in the given order and may be manual.
+// Otherwise the queue follows `runs` when set, or the declaration order,
+// and manual jobs are left out. Unknown job names are reported as errors.
+func buildExecOrder(allJobs []Job, runs []string, selected []string) ([]Job, error) {
+	find := func(name string) (Job, bool) {
+		for _, j := range allJobs {
+			if j.Name == name {
+				return j, true
+			}
+		}
+		return Job{}, false
+	}
+	var out []Job
+	if len(selected) > 0 {
+		for _, name := range selected {
+			j, ok := find(name)
+			if !ok {
+				return nil, fmt.Errorf("job '%s' not found", name)
+			}
+			out = append(out, j)
+		}
+		return out, nil
+	}
+	if len(runs) > 0 {
+		for _, name := range runs {
+			j, ok := find(name)
+			if !ok {
+				return nil, fmt.Errorf("runs entry '%s' does not match any job", name)
+			}
+			if !j.Manual {
+				out = append(out, j)
+			}
+		}
+		return out, nil
+	}
+	for _, j := range allJobs {
+		if !j.Manual {
+			out = append(out, j)
+		}
+	}
+	return out, nil
+}
+
+// commandOptions controls how runLocalCommandExec limits and terminates a
+// command.
+type commandOptions struct {
+	// Timeout is the total time limit (0 disables it).
+	Timeout time.Duration
+	// IdleTimeout is the longest allowed stretch without stdout/stderr
+	// activity (0 disables it).
+	IdleTimeout time.Duration
+	// KillSignal is sent to the process group first when a limit is hit
+	// (0 means SIGKILL right away).
+	KillSignal syscall.Signal
+	// KillGrace is how long to wait after KillSignal before sending SIGKILL.
+	KillGrace time.Duration
+	// Env holds extra KEY=VALUE pairs added to pipejob's own environment.
+	Env []string
+}
+
+// timeoutError is returned (with exit code 124) when a command was stopped
+// because it hit its timeout or idle timeout.
+type timeoutError struct {
+	Reason string        // "timeout" or "idle timeout"
+	Limit  time.Duration // the limit that was exceeded
+	Signal string        // the signal that actually ended the command
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s after %v (terminated by %s)", e.Reason, e.Limit, e.Signal)
+}
+
+// signalNames maps the signals accepted by kill_signal / --kill-signal.
+var signalNames = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// parseSignal parses a signal name such as "SIGTERM", "TERM" or "term".
+func parseSignal(name string) (syscall.Signal, error) {
+	n := strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(n, "SIG") {
+		n = "SIG" + n
+	}
+	if sig, ok := signalNames[n]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unsupported signal '%s' (use SIGTERM, SIGINT, SIGHUP, SIGQUIT or SIGKILL)", name)
+}
+
+// signalName returns the conventional SIG* name of sig.
+func signalName(sig syscall.Signal) string {
+	for n, s := range signalNames {
+		if s == sig {
+			return n
+		}
+	}
+	return sig.String()
+}
+
+// outputWaitDelay is how long runLocalCommandExec keeps reading output after
+// the command exited, when background children still hold stdout/stderr.
+const outputWaitDelay = 2 * time.Second
+
+// activityWriter forwards writes to w and signals activity (non-blocking)
+// for the idle timer.
+type activityWriter struct {
+	w        io.Writer
+	activity chan struct{}
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	n, err := a.w.Write(p)
+	select {
+	case a.activity <- struct{}{}:
+	default:
+	}
+	return n, err
+}
+
 // runLocalCommand runs the given command line via a shell and returns the
-// process exit code and an error (if any). It supports a total `timeout`
-// and an `idleTimeout` which cancels the command if no stdout/stderr
-// activity is observed for the duration. On timeout the function returns
-// exit code 124.
-func runLocalCommandExec(cmdLine string, timeout time.Duration, idleTimeout time.Duration, stdout io.Writer, stderr io.Writer) (int, error) {
+// process exit code and an error (if any). It supports a total timeout and
+// an idle timeout which stops the command if no stdout/stderr activity is
+// observed for the duration. When a limit is hit the process group first
+// receives opts.KillSignal and, if it is still running after opts.KillGrace,
+// SIGKILL. On timeout the function returns exit code 124 and a
+// *timeoutError.
+func runLocalCommandExec(cmdLine string, opts commandOptions, stdout io.Writer, stderr io.Writer) (int, error) {
 	var cmd *exec.Cmd
 	sh := runtimeShell
 	if sh == "" {
@@ -57,28 +261,19 @@ func runLocalCommandExec(cmdLine string, timeout time.Duration, idleTimeout time
 		}
 	}
 
-	// create a cancellable context for the command (total timeout support)
-	cmdCtx, cancel := context.WithCancel(context.Background())
-	if timeout > 0 {
-		var toCancel context.CancelFunc
-		cmdCtx, toCancel = context.WithTimeout(context.Background(), timeout)
-		// wrap cancel so we call both
-		prevCancel := cancel
-		cancel = func() {
-			toCancel()
-			prevCancel()
-		}
-	}
-	defer cancel()
-
-	// build command using context so exec kills on ctx cancel where supported
+	// the command is not bound to a context: timeouts are enforced below so
+	// the process group can be signalled gracefully before being killed
 	switch strings.ToLower(sh) {
 	case "cmd":
-		cmd = exec.CommandContext(cmdCtx, "cmd", "/C", cmdLine)
+		cmd = exec.Command("cmd", "/C", cmdLine)
 	case "powershell":
-		cmd = exec.CommandContext(cmdCtx, "powershell", "-NoProfile", "-Command", cmdLine)
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", cmdLine)
 	default:
-		cmd = exec.CommandContext(cmdCtx, "/bin/sh", "-lc", cmdLine)
+		cmd = exec.Command("/bin/sh", "-lc", cmdLine)
+	}
+
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
 	}
 
 	// ensure children are placed in their own process group on Unix so we
@@ -87,123 +282,100 @@ func runLocalCommandExec(cmdLine string, timeout time.Duration, idleTimeout time
 		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	}
 
-	// use pipes so we can observe stdout/stderr activity for the idle timer
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return 1, err
-	}
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return 1, err
+	// observe stdout/stderr activity for the idle timer. Using writers
+	// (rather than pipes) lets Wait finish copying the output, so nothing
+	// printed right before exit (e.g. by a signal trap) is lost. WaitDelay
+	// bounds how long Wait waits for output held open by background children.
+	activity := make(chan struct{}, 1)
+	cmd.Stdout = &activityWriter{w: stdout, activity: activity}
+	if stderr == stdout {
+		// same writer: exec then uses a single copying goroutine
+		cmd.Stderr = cmd.Stdout
+	} else {
+		cmd.Stderr = &activityWriter{w: stderr, activity: activity}
 	}
+	cmd.WaitDelay = outputWaitDelay
 
 	if err := cmd.Start(); err != nil {
 		return 1, err
 	}
+	setActiveProcess(cmd.Process.Pid)
+	defer setActiveProcess(0)
 
-	activity := make(chan struct{}, 1)
-	// helper to copy and notify activity
-	copyNotify := func(r io.ReadCloser, w io.Writer) {
-		defer r.Close()
-		buf := make([]byte, 4096)
-		for {
-			n, err := r.Read(buf)
-			if n > 0 {
-				// write to provided writer (this may be a bytes.Buffer)
-				w.Write(buf[:n])
-				// notify activity (non-blocking)
-				select {
-				case activity <- struct{}{}:
-				default:
-				}
-			}
-			if err != nil {
-				if err == io.EOF {
-					return
-				}
-				return
-			}
-		}
-	}
-
-	go copyNotify(stdoutPipe, stdout)
-	go copyNotify(stderrPipe, stderr)
-
-	// monitor idle timeout, ctx.Done, and cmd completion
+	// monitor timeouts and cmd completion
 	done := make(chan error, 1)
 	go func() {
 		done <- cmd.Wait()
 	}()
 
-	timedOut := false
-	var waitErr error
-	if idleTimeout > 0 {
-		idleTimer := time.NewTimer(idleTimeout)
+	// nil channels block forever, disabling the corresponding limit
+	var totalC, idleC <-chan time.Time
+	if opts.Timeout > 0 {
+		totalTimer := time.NewTimer(opts.Timeout)
+		defer totalTimer.Stop()
+		totalC = totalTimer.C
+	}
+	var idleTimer *time.Timer
+	if opts.IdleTimeout > 0 {
+		idleTimer = time.NewTimer(opts.IdleTimeout)
 		defer idleTimer.Stop()
-		for {
-			select {
-			case <-activity:
+		idleC = idleTimer.C
+	}
+
+	var waitErr error
+	var tErr *timeoutError
+WAIT:
+	for {
+		select {
+		case <-activity:
+			if idleTimer != nil {
 				if !idleTimer.Stop() {
 					select {
 					case <-idleTimer.C:
 					default:
 					}
 				}
-				idleTimer.Reset(idleTimeout)
-			case <-idleTimer.C:
-				// idle timeout fired
-				timedOut = true
-				cancel()
-				// attempt to kill process group (Unix) or process (Windows)
-				if cmd.Process != nil {
-					if runtime.GOOS != "windows" {
-						// negative pid indicates pgid
-						_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
-					} else {
-						// On Windows try to kill the whole process tree using taskkill
-						if cmd.Process != nil {
-							_ = exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
-						}
-					}
-				}
-				// wait for command to exit
-				waitErr = <-done
-				goto AFTER_WAIT
-			case <-cmdCtx.Done():
-				// total timeout or cancel
-				waitErr = <-done
-				goto AFTER_WAIT
-			case err := <-done:
-				waitErr = err
-				goto AFTER_WAIT
+				idleTimer.Reset(opts.IdleTimeout)
 			}
-		}
-	} else {
-		// no idle timer: just wait for completion or ctx.Done
-		select {
-		case <-cmdCtx.Done():
-			// canceled/timeout
-			timedOut = cmdCtx.Err() == context.DeadlineExceeded
-			if cmd.Process != nil {
-				if runtime.GOOS != "windows" {
-					_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
-				} else {
-					_ = exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
-				}
-			}
-			waitErr = <-done
+		case <-totalC:
+			tErr = &timeoutError{Reason: "timeout", Limit: opts.Timeout}
+			break WAIT
+		case <-idleC:
+			tErr = &timeoutError{Reason: "idle timeout", Limit: opts.IdleTimeout}
+			break WAIT
 		case err := <-done:
 			waitErr = err
+			break WAIT
 		}
 	}
 
-AFTER_WAIT:
-	if waitErr == nil {
-		return 0, nil
+	if tErr != nil {
+		// graceful termination: KillSignal first, SIGKILL after the grace
+		// period. Windows can only force-kill the process tree.
+		sig := opts.KillSignal
+		if sig == 0 || runtime.GOOS == "windows" {
+			sig = syscall.SIGKILL
+		}
+		killProcessGroup(cmd.Process.Pid, sig)
+		tErr.Signal = signalName(sig)
+		if sig != syscall.SIGKILL {
+			grace := time.NewTimer(opts.KillGrace)
+			select {
+			case <-done:
+			case <-grace.C:
+				killProcessGroup(cmd.Process.Pid, syscall.SIGKILL)
+				tErr.Signal = signalName(syscall.SIGKILL)
+				<-done
+			}
+			grace.Stop()
+		} else {
+			<-done
+		}
+		return 124, tErr
 	}
-	// treat ctx deadline exceeded or our timedOut as exit code 124
-	if timedOut || (cmdCtx.Err() == context.DeadlineExceeded) {
-		return 124, waitErr
+
+	if waitErr == nil || waitErr == exec.ErrWaitDelay {
+		return 0, nil
 	}
 	// try to extract exit code from *exec.ExitError
 	if ee, ok := waitErr.(*exec.ExitError); ok {
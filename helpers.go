@@ -1,53 +1,187 @@
 package main
 
 import (
-	"bufio"
-	"os"
+	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 )
 
-func parseEnvFile(path string) (map[string]string, error) {
-	out := map[string]string{}
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+// interpolate substitutes `{{KEY}}` placeholders (also written `{{ KEY }}`,
+// `{{.KEY}}` or `{{ .KEY }}`) with the values in vars, scanning left to
+// right. Substituted values are not scanned again, so the result does not
+// depend on map order. Placeholders of undefined variables are left as-is
+// and `\{{` produces a literal `{{`.
+func interpolate(tmpl string, vars map[string]string) string {
+	if !strings.Contains(tmpl, "{{") {
+		return tmpl
+	}
+	return scanPlaceholders(tmpl, func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	})
+}
+
+// placeholderRefs returns the variable names referenced by tmpl, in order
+// (escaped `\{{` sequences are not references).
+func placeholderRefs(tmpl string) []string {
+	var refs []string
+	if !strings.Contains(tmpl, "{{") {
+		return refs
+	}
+	scanPlaceholders(tmpl, func(name string) (string, bool) {
+		refs = append(refs, name)
+		return "", false
+	})
+	return refs
+}
+
+// scanPlaceholders rewrites tmpl, replacing each `{{name}}` with the value
+// returned by lookup, or keeping it verbatim when lookup reports false.
+func scanPlaceholders(tmpl string, lookup func(name string) (string, bool)) string {
+	return scanTemplate(tmpl, false, lookup)
+}
+
+// rewritePlaceholders is scanPlaceholders for load-time rewrites of
+// templates that are interpolated again later: escaped `\{{` sequences are
+// kept, so they still produce a literal `{{` at runtime.
+func rewritePlaceholders(tmpl string, lookup func(name string) (string, bool)) string {
+	if !strings.Contains(tmpl, "{{") {
+		return tmpl
+	}
+	return scanTemplate(tmpl, true, lookup)
+}
+
+func scanTemplate(tmpl string, keepEscapes bool, lookup func(name string) (string, bool)) string {
+	var sb strings.Builder
+	i := 0
+	for i < len(tmpl) {
+		j := strings.Index(tmpl[i:], "{{")
+		if j < 0 {
+			sb.WriteString(tmpl[i:])
+			break
 		}
-		if !strings.Contains(line, "=") {
+		j += i
+		if j > i && tmpl[j-1] == '\\' {
+			// escaped: emit a literal {{
+			if keepEscapes {
+				sb.WriteString(tmpl[i:j])
+			} else {
+				sb.WriteString(tmpl[i : j-1])
+			}
+			sb.WriteString("{{")
+			i = j + 2
 			continue
 		}
-		parts := strings.SplitN(line, "=", 2)
-		key := strings.TrimSpace(parts[0])
-		val := strings.TrimSpace(parts[1])
-		// strip surrounding quotes if present
-		if strings.HasPrefix(val, "\"") && strings.HasSuffix(val, "\"") {
-			val = strings.Trim(val, "\"")
+		sb.WriteString(tmpl[i:j])
+		end := strings.Index(tmpl[j+2:], "}}")
+		if end < 0 {
+			sb.WriteString(tmpl[j:])
+			break
 		}
-		out[key] = val
+		end += j + 2
+		name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tmpl[j+2:end]), "."))
+		if v, ok := lookup(name); ok {
+			sb.WriteString(v)
+		} else {
+			sb.WriteString(tmpl[j : end+2])
+		}
+		i = end + 2
 	}
-	if scanner.Err() != nil {
-		return nil, scanner.Err()
+	return sb.String()
+}
+
+// resolveVars expands references between variables (`IMAGE:
+// "{{REGISTRY}}/{{REPO}}"`) in dependency order, in place. References to
+// undefined names are left as-is; a reference cycle is returned as an
+// error. The literal variables (the built-ins) are neither expanded nor
+// scanned: their values are not templates, even when they contain {{...}}
+// (e.g. a PIPELINE_NAME of "{{PIPELINE_NAME}}").
+func resolveVars(vars map[string]string, literal map[string]bool) error {
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, k)
 	}
-	return out, nil
+	sort.Strings(names)
+	done := map[string]bool{}
+	visiting := map[string]bool{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] || literal[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("variable reference cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+		visiting[name] = true
+		for _, ref := range placeholderRefs(vars[name]) {
+			if _, ok := vars[ref]; ok {
+				if err := visit(ref, append(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		vars[name] = interpolate(vars[name], vars)
+		done[name] = true
+		return nil
+	}
+	for _, n := range names {
+		if err := visit(n, nil); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func interpolate(tmpl string, vars map[string]string) string {
-	if tmpl == "" {
-		return tmpl
+// unresolvedPlaceholder matches `{{...}}` placeholders left over after
+// interpolation (variables that are not defined).
+var unresolvedPlaceholder = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+
+// evalIfExpr evaluates a job `if:` expression against vars. The expression
+// is interpolated first; placeholders of undefined variables become empty.
+// Supported forms:
+//   - "A == B" / "A != B": trimmed string comparison (quotes are optional)
+//   - "!A": negation of a bare value
+//   - "A": true unless empty, "0", "false", "no" or "off" (case-insensitive)
+func evalIfExpr(expr string, vars map[string]string) bool {
+	s := unresolvedPlaceholder.ReplaceAllString(interpolate(expr, vars), "")
+	s = strings.TrimSpace(s)
+	if l, r, ok := strings.Cut(s, "!="); ok {
+		return unquote(l) != unquote(r)
+	}
+	if l, r, ok := strings.Cut(s, "=="); ok {
+		return unquote(l) == unquote(r)
 	}
-	res := tmpl
-	for k, v := range vars {
-		// support {{KEY}} and {{ KEY }} and {{.KEY}}
-		res = strings.ReplaceAll(res, "{{"+k+"}}", v)
-		res = strings.ReplaceAll(res, "{{ "+k+" }}", v)
-		res = strings.ReplaceAll(res, "{{."+k+"}}", v)
-		res = strings.ReplaceAll(res, "{{ ."+k+" }}", v)
+	if strings.HasPrefix(s, "!") {
+		return !isTruthy(unquote(s[1:]))
+	}
+	return isTruthy(unquote(s))
+}
+
+// isTruthy reports whether a rendered value should be treated as true.
+func isTruthy(v string) bool {
+	switch strings.ToLower(v) {
+	case "", "0", "false", "no", "off":
+		return false
+	}
+	return true
+}
+
+// unquote trims spaces and a single pair of surrounding quotes.
+func unquote(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		v = v[1 : len(v)-1]
+	}
+	return v
+}
+
+// tailLines returns the last n lines of s (without a trailing newline).
+func tailLines(s string, n int) string {
+	s = strings.TrimRight(s, "\n")
+	lines := strings.Split(s, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
 	}
-	return res
+	return strings.Join(lines, "\n")
 }
@@ -0,0 +1,106 @@
+package main
+
+import "reflect"
+
+// notInterpolated lists string fields that interpolateFields leaves alone:
+// names identify steps and jobs, and the other fields are interpolated
+// when they are used (commands right before they run so lazy secrets can
+// load, condition values when they are evaluated, `if` by evalIfExpr).
+var notInterpolated = map[string]bool{
+	"Name":     true,
+	"Command":  true,
+	"Commands": true,
+	"Pattern":  true,
+	"Regex":    true,
+	"Contains": true,
+	"Equals":   true,
+	"If":       true,
+}
+
+// commandFields are the Step fields holding commands.
+var commandFields = map[string]bool{"Command": true, "Commands": true}
+
+var stepSliceType = reflect.TypeOf([]Step(nil))
+
+// interpolateStep returns a copy of step with {{VAR}} placeholders in its
+// string fields (timeouts, goto targets, save_output, ...) substituted.
+// Slices are copied, so the declared step is never modified.
+func interpolateStep(step Step, vars map[string]string) Step {
+	interpolateFields(reflect.ValueOf(&step).Elem(), vars)
+	return step
+}
+
+// interpolateJob does the same for a job's own fields. Its steps are
+// interpolated one at a time when they run, so they see the latest values.
+func interpolateJob(job Job, vars map[string]string) Job {
+	interpolateFields(reflect.ValueOf(&job).Elem(), vars)
+	return job
+}
+
+// interpolateFields substitutes placeholders in the exported string fields
+// of the struct v, recursing into nested structs and slices of structs.
+// Slices are replaced by copies before their elements are changed.
+func interpolateFields(v reflect.Value, vars map[string]string) {
+	rewriteFields(v, notInterpolated, func(s string) string { return interpolate(s, vars) })
+}
+
+// fieldStrings returns the values of the exported string fields of the
+// struct v not named in skip (see rewriteFields), e.g. to find the
+// variables a step uses before it is interpolated.
+func fieldStrings(v interface{}, skip map[string]bool) []string {
+	var out []string
+	cp := reflect.New(reflect.TypeOf(v)).Elem()
+	cp.Set(reflect.ValueOf(v))
+	rewriteFields(cp, skip, func(s string) string {
+		if s != "" {
+			out = append(out, s)
+		}
+		return s
+	})
+	return out
+}
+
+// rewriteFields applies fn to the exported string fields of the struct v
+// not named in skip, recursing like interpolateFields. Slices and maps are
+// replaced by copies, so values shared with other structs are not changed.
+func rewriteFields(v reflect.Value, skip map[string]bool, fn func(string) string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		sf := t.Field(i)
+		if !f.CanSet() || skip[sf.Name] || sf.Type == stepSliceType {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(fn(f.String()))
+		case reflect.Struct:
+			rewriteFields(f, skip, fn)
+		case reflect.Slice:
+			if f.Len() == 0 {
+				continue
+			}
+			cp := reflect.MakeSlice(f.Type(), f.Len(), f.Len())
+			reflect.Copy(cp, f)
+			for j := 0; j < cp.Len(); j++ {
+				switch e := cp.Index(j); e.Kind() {
+				case reflect.String:
+					e.SetString(fn(e.String()))
+				case reflect.Struct:
+					rewriteFields(e, skip, fn)
+				}
+			}
+			f.Set(cp)
+		case reflect.Map:
+			if f.Len() == 0 || f.Type().Elem().Kind() != reflect.String {
+				continue
+			}
+			cp := reflect.MakeMapWithSize(f.Type(), f.Len())
+			iter := f.MapRange()
+			for iter.Next() {
+				cp.SetMapIndex(iter.Key(), reflect.ValueOf(fn(iter.Value().String())).Convert(f.Type().Elem()))
+			}
+			f.Set(cp)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"A": "{{B}}", "B": "b", "NAME": "x"}
+	cases := map[string]string{
+		"{{NAME}} {{ NAME }} {{.NAME}} {{ .NAME }}": "x x x x",
+		"{{A}}":              "{{B}}", // values are not scanned again
+		"{{MISSING}}-{{B}}":  "{{MISSING}}-b",
+		`\{{NAME}} {{NAME}}`: "{{NAME}} x",
+		"open {{NAME":        "open {{NAME",
+	}
+	for in, want := range cases {
+		if got := interpolate(in, vars); got != want {
+			t.Errorf("interpolate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestResolveVars(t *testing.T) {
+	vars := map[string]string{
+		"IMAGE":    "{{REGISTRY}}/{{REPO}}:{{TAG}}",
+		"REGISTRY": "{{HOST}}:5000",
+		"HOST":     "registry.local",
+		"REPO":     "team/app",
+		"TAG":      "1.2",
+		"LITERAL":  `\{{HOST}}`,
+		"UNKNOWN":  "{{NOPE}}",
+	}
+	if err := resolveVars(vars, nil); err != nil {
+		t.Fatalf("resolveVars: %v", err)
+	}
+	if vars["IMAGE"] != "registry.local:5000/team/app:1.2" {
+		t.Errorf("IMAGE = %q", vars["IMAGE"])
+	}
+	if vars["LITERAL"] != "{{HOST}}" || vars["UNKNOWN"] != "{{NOPE}}" {
+		t.Errorf("LITERAL = %q, UNKNOWN = %q", vars["LITERAL"], vars["UNKNOWN"])
+	}
+
+	cyc := map[string]string{"A": "{{B}}", "B": "x{{C}}", "C": "{{A}}"}
+	err := resolveVars(cyc, nil)
+	if err == nil || !strings.Contains(err.Error(), "A -> B -> C -> A") {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+}
+
+func TestVariableCycleFailsAtLoad(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: cycle
+  variables:
+    A: "{{B}}"
+    B: "{{A}}"
+  jobs:
+    - name: j1
+      steps:
+        - name: s1
+          type: command
+          command: echo "RAN"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath})
+	})
+	if rc != 6 || strings.Contains(out, "RAN") {
+		t.Fatalf("expected exit code 6 before any command, got %d: %s", rc, out)
+	}
+}
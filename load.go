@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadPipelineFile reads a pipeline file and merges the files listed in its
+// top-level `include:` (paths or globs, relative to the including file).
+// Included files contribute jobs, variables and templates; the including
+// file wins on conflicts. Templates are not expanded here, see
+// expandTemplates.
+func loadPipelineFile(path string) (*PipelineFile, error) {
+	return loadWithIncludes(path, nil)
+}
+
+func loadWithIncludes(path string, stack []string) (*PipelineFile, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	if onStack(abs, stack) {
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+	}
+	stack = append(stack, abs)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p PipelineFile
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	resolveUsesPaths(&p, filepath.Dir(path))
+
+	// includes first (in order), so the file's own definitions override them
+	var base PipelineFile
+	for _, inc := range p.Include {
+		pattern := inc
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include '%s': %v", path, inc, err)
+		}
+		isGlob := strings.ContainsAny(inc, "*?[")
+		if len(matches) == 0 && !isGlob {
+			return nil, fmt.Errorf("%s: included file '%s' not found", path, inc)
+		}
+		for _, m := range matches {
+			// a glob like `*.yaml` may match the including file itself or
+			// another file being loaded; only explicit paths are cycles
+			if isGlob {
+				if am, err := filepath.Abs(m); err == nil && onStack(am, stack) {
+					continue
+				}
+			}
+			ip, err := loadWithIncludes(m, stack)
+			if err != nil {
+				return nil, err
+			}
+			mergeInclude(&base, ip)
+		}
+	}
+	mergeInclude(&base, &p)
+	// everything except the merged parts comes from the including file
+	merged := p
+	merged.Pipeline.Variables = base.Pipeline.Variables
+	merged.Pipeline.Jobs = base.Pipeline.Jobs
+	merged.Templates = base.Templates
+	merged.Include = nil
+	return &merged, nil
+}
+
+// onStack reports whether the file abs is being loaded already.
+func onStack(abs string, stack []string) bool {
+	for _, s := range stack {
+		if s == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeInclude merges the variables, jobs and templates of src into dst.
+// Entries of src replace same-named ones in dst (jobs keep their position);
+// new jobs are appended.
+func mergeInclude(dst, src *PipelineFile) {
+	if len(src.Pipeline.Variables) > 0 && dst.Pipeline.Variables == nil {
+		dst.Pipeline.Variables = map[string]string{}
+	}
+	for k, v := range src.Pipeline.Variables {
+		dst.Pipeline.Variables[k] = v
+	}
+	for _, j := range src.Pipeline.Jobs {
+		replaced := false
+		for i := range dst.Pipeline.Jobs {
+			if dst.Pipeline.Jobs[i].Name == j.Name {
+				dst.Pipeline.Jobs[i] = j
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			dst.Pipeline.Jobs = append(dst.Pipeline.Jobs, j)
+		}
+	}
+	if len(src.Templates.Jobs) > 0 && dst.Templates.Jobs == nil {
+		dst.Templates.Jobs = map[string]Job{}
+	}
+	for k, v := range src.Templates.Jobs {
+		dst.Templates.Jobs[k] = v
+	}
+	if len(src.Templates.Steps) > 0 && dst.Templates.Steps == nil {
+		dst.Templates.Steps = map[string]Step{}
+	}
+	for k, v := range src.Templates.Steps {
+		dst.Templates.Steps[k] = v
+	}
+}
+
+// expandTemplates resolves `extends` on every job and step (jobs, post
+// steps, finally jobs and on_failure steps). Fields set on the job or step
+// override the template's; templates may extend other templates.
+func expandTemplates(p *PipelineFile) error {
+	t := &templateResolver{tpl: p.Templates, jobs: map[string]Job{}, steps: map[string]Step{}}
+	expandJobs := func(jobs []Job) error {
+		for i := range jobs {
+			j, err := t.job(jobs[i])
+			if err != nil {
+				return err
+			}
+			jobs[i] = j
+		}
+		return nil
+	}
+	if err := expandJobs(p.Pipeline.Jobs); err != nil {
+		return err
+	}
+	if err := expandJobs(p.Pipeline.Finally); err != nil {
+		return err
+	}
+	if of := p.Pipeline.OnFailure; of != nil {
+		steps, err := t.stepList(of.Steps, "on_failure")
+		if err != nil {
+			return err
+		}
+		of.Steps = steps
+	}
+	return nil
+}
+
+// templateResolver expands templates, caching resolved ones and detecting
+// extends cycles.
+type templateResolver struct {
+	tpl       Templates
+	jobs      map[string]Job
+	steps     map[string]Step
+	resolving []string
+}
+
+func (t *templateResolver) enter(kind, name string) error {
+	key := kind + " " + name
+	for _, r := range t.resolving {
+		if r == key {
+			return fmt.Errorf("extends cycle: %s", strings.Join(append(t.resolving, key), " -> "))
+		}
+	}
+	t.resolving = append(t.resolving, key)
+	return nil
+}
+
+func (t *templateResolver) leave() { t.resolving = t.resolving[:len(t.resolving)-1] }
+
+// job returns j with its template (if any) applied and its steps expanded.
+func (t *templateResolver) job(j Job) (Job, error) {
+	return t.expandJob(j, "job "+j.Name)
+}
+
+// expandJob is job with the error context given by label, so template
+// errors name the template rather than an empty job name.
+func (t *templateResolver) expandJob(j Job, label string) (Job, error) {
+	if j.Extends != "" {
+		base, err := t.jobTemplate(j.Extends)
+		if err != nil {
+			return Job{}, fmt.Errorf("%s: %v", label, err)
+		}
+		j = overlayJob(base, j)
+	}
+	var err error
+	if j.Steps, err = t.stepList(j.Steps, label); err != nil {
+		return Job{}, err
+	}
+	if j.Post, err = t.stepList(j.Post, label+" post"); err != nil {
+		return Job{}, err
+	}
+	return j, nil
+}
+
+func (t *templateResolver) jobTemplate(name string) (Job, error) {
+	if j, ok := t.jobs[name]; ok {
+		return j, nil
+	}
+	tj, ok := t.tpl.Jobs[name]
+	if !ok {
+		return Job{}, fmt.Errorf("unknown job template '%s'", name)
+	}
+	if err := t.enter("job template", name); err != nil {
+		return Job{}, err
+	}
+	defer t.leave()
+	j, err := t.expandJob(tj, "job template "+name)
+	if err != nil {
+		return Job{}, err
+	}
+	t.jobs[name] = j
+	return j, nil
+}
+
+func (t *templateResolver) stepList(steps []Step, owner string) ([]Step, error) {
+	if len(steps) == 0 {
+		return steps, nil
+	}
+	out := make([]Step, len(steps))
+	for i, s := range steps {
+		st, err := t.step(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", owner, err)
+		}
+		out[i] = st
+	}
+	return out, nil
+}
+
+func (t *templateResolver) step(s Step) (Step, error) {
+	st, err := t.expandStep(s)
+	if err != nil {
+		return Step{}, fmt.Errorf("step %s: %v", s.Name, err)
+	}
+	return st, nil
+}
+
+// expandStep applies the template chain of s without adding context to
+// errors, so nested templates report a single "extends cycle" line.
+func (t *templateResolver) expandStep(s Step) (Step, error) {
+	if s.Extends == "" {
+		return s, nil
+	}
+	base, err := t.stepTemplate(s.Extends)
+	if err != nil {
+		return Step{}, err
+	}
+	return overlayStep(base, s), nil
+}
+
+func (t *templateResolver) stepTemplate(name string) (Step, error) {
+	if s, ok := t.steps[name]; ok {
+		return s, nil
+	}
+	ts, ok := t.tpl.Steps[name]
+	if !ok {
+		return Step{}, fmt.Errorf("unknown step template '%s'", name)
+	}
+	if err := t.enter("step template", name); err != nil {
+		return Step{}, err
+	}
+	defer t.leave()
+	s, err := t.expandStep(ts)
+	if err != nil {
+		return Step{}, err
+	}
+	t.steps[name] = s
+	return s, nil
+}
+
+// overlayJob returns the template job base with every field set on j
+// copied onto it. The result no longer extends anything.
+func overlayJob(base, j Job) Job {
+	overlayFields(reflect.ValueOf(&base).Elem(), reflect.ValueOf(j))
+	base.Extends = ""
+	return base
+}
+
+// overlayStep does the same for steps.
+func overlayStep(base, s Step) Step {
+	overlayFields(reflect.ValueOf(&base).Elem(), reflect.ValueOf(s))
+	base.Extends = ""
+	return base
+}
+
+// overlayFields copies the non-zero exported fields of src onto dst, so a
+// field can't be reset to its zero value (e.g. `silent: false`) by a job or
+// step extending a template.
+func overlayFields(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		f := dst.Field(i)
+		if !f.CanSet() || src.Field(i).IsZero() {
+			continue
+		}
+		f.Set(src.Field(i))
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLogBufferSize is the in-memory log size kept for error evidence
+// when --log-buffer-size is not given.
+const defaultLogBufferSize = 300 * 1024
+
+// ringBuffer keeps the most recent `size` bytes of the run log in a fixed
+// buffer. Bytes pushed out of the buffer are either appended to a spill file
+// (when spilling is enabled) or counted as truncated.
+type ringBuffer struct {
+	mu        sync.Mutex
+	size      int
+	buf       []byte // grows up to size, then wraps
+	start     int    // index of the oldest byte once buf is full
+	truncated int64  // evicted bytes that were not spilled
+
+	spill      bool
+	spillFile  *os.File
+	spillBytes int64
+}
+
+// newRingBuffer returns a buffer holding up to size bytes. With spill set,
+// overflow goes to a temp file instead of being dropped.
+func newRingBuffer(size int, spill bool) *ringBuffer {
+	return &ringBuffer{size: size, spill: spill}
+}
+
+// Write appends p, evicting the oldest bytes once the buffer is full.
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(p)
+	if free := r.size - len(r.buf); free > 0 {
+		k := free
+		if len(p) < k {
+			k = len(p)
+		}
+		r.buf = append(r.buf, p[:k]...)
+		p = p[k:]
+	}
+	for len(p) > 0 {
+		k := r.size - r.start
+		if len(p) < k {
+			k = len(p)
+		}
+		r.evict(r.buf[r.start : r.start+k])
+		copy(r.buf[r.start:], p[:k])
+		r.start = (r.start + k) % r.size
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// evict hands bytes leaving the buffer to the spill file, or counts them as
+// truncated when spilling is off or the spill file can't be written.
+func (r *ringBuffer) evict(b []byte) {
+	if r.spill {
+		if r.spillFile == nil {
+			f, err := os.CreateTemp("", "pipejob-spill-*.log")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to create log spill file: %v\n", err)
+				r.spill = false
+			}
+			r.spillFile = f
+		}
+		if r.spillFile != nil {
+			n, _ := r.spillFile.Write(b)
+			r.spillBytes += int64(n)
+			r.truncated += int64(len(b) - n)
+			return
+		}
+	}
+	r.truncated += int64(len(b))
+}
+
+// WriteTo writes the retained log to w: the spilled overflow first, then
+// the buffer in order. If bytes were dropped, a "N bytes truncated" marker
+// line comes first.
+func (r *ringBuffer) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total int64
+	if r.truncated > 0 {
+		n, err := fmt.Fprintf(w, "[pipejob] %d bytes truncated (log buffer size %d bytes, see --log-buffer-size)\n", r.truncated, r.size)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	if r.spillFile != nil {
+		if _, err := r.spillFile.Seek(0, io.SeekStart); err != nil {
+			return total, err
+		}
+		n, err := io.Copy(w, r.spillFile)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	for _, part := range [][]byte{r.buf[r.start:], r.buf[:r.start]} {
+		n, err := w.Write(part)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Close removes the spill file, if any.
+func (r *ringBuffer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.spillFile == nil {
+		return nil
+	}
+	name := r.spillFile.Name()
+	r.spillFile.Close()
+	r.spillFile = nil
+	return os.Remove(name)
+}
+
+// linePrefixWriter splits command output into lines and hands each one to
+// emit prefixed with a timestamp and a label (job/step). A trailing partial
+// line is kept until the next newline or Flush.
+type linePrefixWriter struct {
+	mu      sync.Mutex
+	label   string
+	emit    func([]byte)
+	partial []byte
+}
+
+func newLinePrefixWriter(label string, emit func([]byte)) *linePrefixWriter {
+	return &linePrefixWriter{label: label, emit: emit}
+}
+
+func (w *linePrefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits a pending line that did not end with a newline.
+func (w *linePrefixWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		w.writeLine(w.partial)
+		w.partial = nil
+	}
+}
+
+func (w *linePrefixWriter) writeLine(line []byte) {
+	prefix := time.Now().Format("2006-01-02T15:04:05.000") + " [" + w.label + "] "
+	out := make([]byte, 0, len(prefix)+len(line)+1)
+	out = append(out, prefix...)
+	out = append(out, line...)
+	w.emit(append(out, '\n'))
+}
+
+// writeLogFile writes the retained log to path.
+func writeLogFile(path string, r *ringBuffer) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := r.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseByteSize parses sizes such as "300000", "512K", "300KB" or "2M"
+// (binary multiples).
+func parseByteSize(s string) (int, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	mult := 1
+	switch {
+	case strings.HasSuffix(v, "K"):
+		mult, v = 1024, strings.TrimSuffix(v, "K")
+	case strings.HasSuffix(v, "M"):
+		mult, v = 1024*1024, strings.TrimSuffix(v, "M")
+	case strings.HasSuffix(v, "G"):
+		mult, v = 1024*1024*1024, strings.TrimSuffix(v, "G")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size '%s' (e.g. 300K, 1M)", s)
+	}
+	return n * mult, nil
+}
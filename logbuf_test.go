@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRingBufferKeepsTailAndMarksTruncation(t *testing.T) {
+	r := newRingBuffer(8, false)
+	r.Write([]byte("abcdef"))
+	r.Write([]byte("ghijk"))
+	r.Write([]byte("lm"))
+	var out bytes.Buffer
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	got := out.String()
+	if !strings.HasPrefix(got, "[pipejob] 5 bytes truncated") {
+		t.Fatalf("expected truncation marker, got %q", got)
+	}
+	if !strings.HasSuffix(got, "\nfghijklm") {
+		t.Fatalf("expected the last 8 bytes, got %q", got)
+	}
+}
+
+func TestRingBufferSpillKeepsEverything(t *testing.T) {
+	r := newRingBuffer(4, true)
+	r.Write([]byte("0123456789"))
+	r.Write([]byte("abc"))
+	spill := r.spillFile.Name()
+	var out bytes.Buffer
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if got := out.String(); got != "0123456789abc" {
+		t.Fatalf("expected the full log, got %q", got)
+	}
+	r.Close()
+	if _, err := os.Stat(spill); !os.IsNotExist(err) {
+		t.Fatalf("expected spill file %s to be removed", spill)
+	}
+}
+
+func TestLogBufferSizeFlag(t *testing.T) {
+	tmp := t.TempDir()
+	// the logged command line alone overflows a 1K buffer
+	yaml := `pipeline:
+  name: smallbuf
+  jobs:
+    - name: j1
+      steps:
+        - name: noisy
+          type: command
+          command: "echo ` + strings.Repeat("x", 3000) + ` >/dev/null; exit 1"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	var rc int
+	captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath, "--log-buffer-size", "1K"})
+	})
+	if rc != 5 {
+		t.Fatalf("expected exit code 5, got %d", rc)
+	}
+	logs, _ := filepath.Glob(filepath.Join(tmp, ".sync_temp", "pipejob-*", "run.log"))
+	if len(logs) != 1 {
+		t.Fatalf("expected one flushed run.log, got %v", logs)
+	}
+	data, err := os.ReadFile(logs[0])
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if !strings.Contains(string(data), "bytes truncated") || len(data) > 1200 {
+		t.Fatalf("expected a truncated ~1K log, got %d bytes", len(data))
+	}
+
+	if rc := RunWithArgs([]string{yamlPath, "--log-buffer-size", "lots"}); rc != 2 {
+		t.Fatalf("expected exit code 2 for an invalid size, got %d", rc)
+	}
+}
+
+func TestCommandOutputIsLogged(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: evidence
+  jobs:
+    - name: build
+      steps:
+        - name: compile
+          type: command
+          silent: true
+          command: "echo 'error: missing semicolon' >&2; exit 1"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	logDir := filepath.Join(tmp, "logs")
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath, "--persist-logs", logDir})
+	})
+	if rc != 5 {
+		t.Fatalf("expected exit code 5, got %d", rc)
+	}
+	if strings.Contains(out, "\nerror: missing semicolon") {
+		t.Fatalf("silent step output should not reach the terminal, got: %s", out)
+	}
+	data, err := os.ReadFile(filepath.Join(logDir, "run.log"))
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if !strings.Contains(string(data), "[build/compile] error: missing semicolon") {
+		t.Fatalf("expected prefixed command output in run.log, got: %s", data)
+	}
+}
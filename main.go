@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -23,6 +27,24 @@ var runtimeShell string
 // the global `--silent` flag.
 var globalSilent bool
 
+// defaultMaxJumps is the jump limit used when pipeline.max_jumps is unset.
+// It keeps goto-driven loops from running forever.
+const defaultMaxJumps = 1000
+
+// defaultKillGrace is how long a command may take to exit after it was sent
+// a termination signal (a forwarded SIGINT/SIGTERM, or kill_signal on
+// timeout) before its process group is killed, unless kill_grace or
+// --kill-grace say otherwise.
+const defaultKillGrace = 5 * time.Second
+
+// failedOutputLines is the number of trailing output lines of the failed
+// step exposed to on_failure as {{FAILED_OUTPUT}}.
+const failedOutputLines = 20
+
+// jumpTrailSize is the number of most recent jumps printed when a loop
+// limit is exceeded.
+const jumpTrailSize = 20
+
 // Types and small helpers have been moved to types.go and helpers.go to keep
 // this file focused on CLI and execution flow. See types.go for
 // `PipelineFile`, `Job`, `Step`, and `kvList` definitions.
@@ -37,19 +59,29 @@ func RunWithArgs(args []string) (rc int) {
 	// or after the positional YAML file). We extract supported flags and
 	// return a cleaned args slice for positional handling.
 	var cliVars kvList
-	envFile := ".env"
+	var selectedJobs kvList
+	var envFiles, varsFiles kvList
+	printVarsOnly := false
+	profileName := ""
+	policyPath := ""
+	confirmed := false
+	showHelp := false
 	dryRun := false
 	persistLogs := ""
+	logBufferSizeStr := ""
+	logSpill := false
 	shellHint := "" // optional shell override: sh|cmd|powershell
 	var defaultIdleTimeoutStr string
+	var defaultKillSignalStr, defaultKillGraceStr string
 
 	cleaned := make([]string, 0, len(args))
 	for i := 0; i < len(args); {
 		a := args[i]
 		// help flag anywhere should display usage and exit
 		if a == "--help" || a == "-h" {
-			printHelp()
-			return 0
+			showHelp = true
+			i++
+			continue
 		}
 		if strings.HasPrefix(a, "--var=") {
 			cliVars.Set(strings.TrimPrefix(a, "--var="))
@@ -65,20 +97,86 @@ func RunWithArgs(args []string) (rc int) {
 			fmt.Fprintln(os.Stderr, "--var requires an argument")
 			return 2
 		}
+		if strings.HasPrefix(a, "--job=") {
+			selectedJobs.Set(strings.TrimPrefix(a, "--job="))
+			i++
+			continue
+		}
+		if a == "--job" {
+			if i+1 < len(args) {
+				selectedJobs.Set(args[i+1])
+				i += 2
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "--job requires an argument")
+			return 2
+		}
 		if strings.HasPrefix(a, "--env-file=") {
-			envFile = strings.TrimPrefix(a, "--env-file=")
+			envFiles.Set(strings.TrimPrefix(a, "--env-file="))
 			i++
 			continue
 		}
 		if a == "--env-file" {
 			if i+1 < len(args) {
-				envFile = args[i+1]
+				envFiles.Set(args[i+1])
 				i += 2
 				continue
 			}
 			fmt.Fprintln(os.Stderr, "--env-file requires an argument")
 			return 2
 		}
+		if strings.HasPrefix(a, "--vars-file=") {
+			varsFiles.Set(strings.TrimPrefix(a, "--vars-file="))
+			i++
+			continue
+		}
+		if a == "--vars-file" {
+			if i+1 < len(args) {
+				varsFiles.Set(args[i+1])
+				i += 2
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "--vars-file requires an argument")
+			return 2
+		}
+		if strings.HasPrefix(a, "--profile=") {
+			profileName = strings.TrimPrefix(a, "--profile=")
+			i++
+			continue
+		}
+		if a == "--profile" {
+			if i+1 < len(args) {
+				profileName = args[i+1]
+				i += 2
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "--profile requires an argument")
+			return 2
+		}
+		if strings.HasPrefix(a, "--policy=") {
+			policyPath = strings.TrimPrefix(a, "--policy=")
+			i++
+			continue
+		}
+		if a == "--policy" {
+			if i+1 < len(args) {
+				policyPath = args[i+1]
+				i += 2
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "--policy requires an argument")
+			return 2
+		}
+		if a == "--confirm" {
+			confirmed = true
+			i++
+			continue
+		}
+		if a == "--print-vars" {
+			printVarsOnly = true
+			i++
+			continue
+		}
 		if a == "--dry-run" || strings.HasPrefix(a, "--dry-run=") {
 			if a == "--dry-run" {
 				dryRun = true
@@ -94,6 +192,26 @@ func RunWithArgs(args []string) (rc int) {
 			i++
 			continue
 		}
+		if strings.HasPrefix(a, "--log-buffer-size=") {
+			logBufferSizeStr = strings.TrimPrefix(a, "--log-buffer-size=")
+			i++
+			continue
+		}
+		if a == "--log-buffer-size" {
+			if i+1 < len(args) {
+				logBufferSizeStr = args[i+1]
+				i += 2
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "--log-buffer-size requires an argument (e.g. 300K, 1M)")
+			return 2
+		}
+		if a == "--log-spill" || strings.HasPrefix(a, "--log-spill=") {
+			v := strings.TrimPrefix(strings.TrimPrefix(a, "--log-spill"), "=")
+			logSpill = !(v == "false" || v == "0")
+			i++
+			continue
+		}
 		if strings.HasPrefix(a, "--idle-timeout=") {
 			defaultIdleTimeoutStr = strings.TrimPrefix(a, "--idle-timeout=")
 			i++
@@ -108,6 +226,34 @@ func RunWithArgs(args []string) (rc int) {
 			fmt.Fprintln(os.Stderr, "--idle-timeout requires an argument (Go duration, e.g. 2s)")
 			return 2
 		}
+		if strings.HasPrefix(a, "--kill-signal=") {
+			defaultKillSignalStr = strings.TrimPrefix(a, "--kill-signal=")
+			i++
+			continue
+		}
+		if a == "--kill-signal" {
+			if i+1 < len(args) {
+				defaultKillSignalStr = args[i+1]
+				i += 2
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "--kill-signal requires an argument (e.g. SIGTERM)")
+			return 2
+		}
+		if strings.HasPrefix(a, "--kill-grace=") {
+			defaultKillGraceStr = strings.TrimPrefix(a, "--kill-grace=")
+			i++
+			continue
+		}
+		if a == "--kill-grace" {
+			if i+1 < len(args) {
+				defaultKillGraceStr = args[i+1]
+				i += 2
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "--kill-grace requires an argument (Go duration, e.g. 10s)")
+			return 2
+		}
 		if strings.HasPrefix(a, "--shell=") {
 			shellHint = strings.TrimPrefix(a, "--shell=")
 			i++
@@ -147,6 +293,22 @@ func RunWithArgs(args []string) (rc int) {
 		i++
 	}
 
+	// --help prints the usage; with a pipeline file it also lists the
+	// pipeline's params
+	if showHelp {
+		printHelp()
+		if len(cleaned) == 0 || cleaned[0] == "new" {
+			return 0
+		}
+		hp, err := loadPipelineFile(cleaned[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load %s: %v\n", cleaned[0], err)
+			return 2
+		}
+		printParams(hp.Pipeline.Name, hp.Pipeline.Params)
+		return 0
+	}
+
 	// If subcommand 'new' is requested it will be the first cleaned arg.
 	if len(cleaned) > 0 && cleaned[0] == "new" {
 		newFs := flag.NewFlagSet("new", flag.ContinueOnError)
@@ -188,82 +350,275 @@ func RunWithArgs(args []string) (rc int) {
 	// expose shell hint to runLocalCommand via package-level variable
 	runtimeShell = shellHint
 
-	// Read YAML
-	b, err := os.ReadFile(yamlPath)
+	// global termination defaults (step-level kill_signal/kill_grace win)
+	var globalKillSignal syscall.Signal
+	if defaultKillSignalStr != "" {
+		sig, err := parseSignal(defaultKillSignalStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --kill-signal: %v\n", err)
+			return 2
+		}
+		globalKillSignal = sig
+	}
+	globalKillGrace := defaultKillGrace
+	if defaultKillGraceStr != "" {
+		d, err := time.ParseDuration(defaultKillGraceStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --kill-grace value '%s': %v\n", defaultKillGraceStr, err)
+			return 2
+		}
+		globalKillGrace = d
+	}
+
+	// Read YAML, merging `include:` files, then expand `extends` templates
+	// and `uses` actions
+	pf, err := loadPipelineFile(yamlPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", yamlPath, err)
+		fmt.Fprintf(os.Stderr, "failed to load %s: %v\n", yamlPath, err)
 		return 2
 	}
+	p := *pf
+	if err := expandTemplates(&p); err != nil {
+		fmt.Fprintf(os.Stderr, "pipejob: %v\n", err)
+		return 6
+	}
+	if err := expandActions(&p); err != nil {
+		fmt.Fprintf(os.Stderr, "pipejob: %v\n", err)
+		return 6
+	}
 
-	// Quick check: reject if there is an `execution` with mode: live to be safe.
-	var root map[string]interface{}
-	if err := yaml.Unmarshal(b, &root); err == nil {
-		if execVal, ok := root["execution"]; ok {
-			if em, ok2 := execVal.(map[string]interface{}); ok2 {
-				if mm, ok3 := em["mode"]; ok3 {
-					if ms, ok4 := mm.(string); ok4 && strings.ToLower(ms) == "live" {
-						fmt.Fprintln(os.Stderr, "pipejob: refusing to run pipeline with execution.mode=live in minimal local tool")
-						return 3
-					}
-				}
-			}
+	// the safety policy (.pipejob-policy.yaml or --policy) is enforced before
+	// and during execution; violations exit with code 3. Without a policy
+	// file only execution.mode=live is refused.
+	policy, err := loadPolicy(policyPath, filepath.Dir(yamlPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pipejob: invalid policy: %v\n", err)
+		return 2
+	}
+	if err := policy.checkExecutionMode(p.Execution.Mode); err != nil {
+		fmt.Fprintf(os.Stderr, "pipejob: refusing to run: %v\n", err)
+		return 3
+	}
+
+	// Prepare temp workspace name (also exposed as {{RUN_DIR}}). Logs are
+	// buffered in-memory and only written to disk when (a) the user
+	// requested `--persist-logs` or (b) the run exits non-zero (error) —
+	// this preserves logs by default on error while avoiding log writes on
+	// successful runs.
+	startTime := time.Now()
+	// named after the run id (timestamp plus random suffix) so concurrent
+	// runs never share, or remove, each other's workspace
+	runID := newRunID(startTime)
+	tempBase := ".sync_temp"
+	tempDir := filepath.Join(tempBase, "pipejob-"+runID)
+	if persistLogs != "" {
+		tempDir = persistLogs
+	}
 
+	// Build variables, lowest to highest precedence: built-ins -> param
+	// defaults -> pipeline vars -> profile vars -> --vars-file (in order) ->
+	// env files (in order) -> --var. varSources records where each final
+	// value came from (see --print-vars).
+	vars := map[string]string{}
+	varSources := map[string]string{}
+	setVars := func(src string, m map[string]string) {
+		for k, v := range m {
+			vars[k] = v
+			varSources[k] = src
 		}
 	}
+	// built-ins come first so every other source can override them
+	setVars("built-in", runBuiltins(p.Pipeline.Name, yamlPath, runID, tempDir, startTime))
+	if err := validateParamDefs(p.Pipeline.Params); err != nil {
+		fmt.Fprintf(os.Stderr, "pipejob: %v\n", err)
+		return 6
+	}
+	setVars("param default", paramDefaults(p.Pipeline.Params))
+	setVars("pipeline variables", p.Pipeline.Variables)
 
-	var p PipelineFile
-	if err := yaml.Unmarshal(b, &p); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to parse yaml %s: %v\n", yamlPath, err)
-		return 2
+	// --profile selects a named environment; protected ones (e.g. prod)
+	// need an explicit --confirm, like execution.mode=live is refused
+	var profile Profile
+	if profileName != "" {
+		pr, ok := p.Pipeline.Profiles[profileName]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "pipejob: unknown profile '%s' (available: %s)\n", profileName, profileNames(p.Pipeline.Profiles))
+			return 2
+		}
+		if pr.Protected && !confirmed && !printVarsOnly {
+			fmt.Fprintf(os.Stderr, "pipejob: profile '%s' is protected; re-run with --confirm to execute it\n", profileName)
+			return 3
+		}
+		profile = pr
+		setVars("profile "+profileName, pr.Variables)
 	}
 
-	// Build variables: pipeline vars -> env file -> CLI vars (CLI highest precedence)
-	vars := map[string]string{}
-	for k, v := range p.Pipeline.Variables {
-		vars[k] = v
+	for _, vf := range varsFiles {
+		vfVars, err := loadVarsFile(vf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pipejob: invalid vars file %v\n", err)
+			return 2
+		}
+		setVars("vars file "+vf, vfVars)
 	}
 
-	// load .env if present
-	if envFile != "" {
-		if efVars, err := parseEnvFile(envFile); err == nil {
-			for k, v := range efVars {
-				vars[k] = v
-			}
+	// env files: .env unless --env-file is given. Only the default .env
+	// may be missing; a named file that is missing or can't be parsed is
+	// an error.
+	defaultEnvFile := len(envFiles) == 0
+	if defaultEnvFile {
+		envFiles = kvList{".env"}
+	}
+	for _, ef := range envFiles {
+		efVars, err := parseEnvFile(ef)
+		if err != nil && !(defaultEnvFile && os.IsNotExist(err)) {
+			fmt.Fprintf(os.Stderr, "pipejob: invalid env file %v\n", err)
+			return 2
 		}
+		setVars("env file "+ef, efVars)
 	}
 
-	// apply CLI vars (key=val)
+	// apply CLI vars (key=val). When the pipeline declares params, a key
+	// must be a param or a variable from another source, so typos fail
+	// instead of silently falling back to defaults.
+	declared := map[string]bool{}
+	for _, pr := range p.Pipeline.Params {
+		declared[pr.Name] = true
+	}
 	for _, kv := range cliVars {
 		parts := strings.SplitN(kv, "=", 2)
 		if len(parts) != 2 {
 			fmt.Fprintf(os.Stderr, "invalid --var value: %s (expected key=val)\n", kv)
 			return 2
 		}
-		vars[parts[0]] = parts[1]
+		if _, known := vars[parts[0]]; len(declared) > 0 && !known && !declared[parts[0]] {
+			fmt.Fprintf(os.Stderr, "pipejob: %v\n", unknownVarError(parts[0], p.Pipeline.Params))
+			return 2
+		}
+		setVars("--var", map[string]string{parts[0]: parts[1]})
 	}
 
-	// Prepare temp workspace name. We avoid creating the temp dir or log
-	// file unless needed to minimize IO. Logs are buffered in-memory and
-	// only written to disk when (a) the user requested `--persist-logs` or
-	// (b) the run exits non-zero (error) — this preserves logs by default on
-	// error while avoiding disk writes on successful runs.
-	ts := time.Now().Format("20060102-150405")
-	tempBase := ".sync_temp"
-	tempDir := filepath.Join(tempBase, "pipejob-"+ts)
-	if persistLogs != "" {
-		// use persist dir if requested; create it now so we can stream logs
-		tempDir = persistLogs
+	// variables may reference each other; expand them once, in dependency
+	// order, so commands see the final values
+	builtins := map[string]bool{}
+	for name, src := range varSources {
+		if src == "built-in" {
+			builtins[name] = true
+		}
+	}
+	if err := resolveVars(vars, builtins); err != nil {
+		fmt.Fprintf(os.Stderr, "pipejob: %v\n", err)
+		return 6
+	}
+
+	// params are checked against the final values
+	if err := checkParams(p.Pipeline.Params, vars); err != nil {
+		fmt.Fprintf(os.Stderr, "pipejob: invalid params:\n  %v\n", err)
+		return 2
+	}
+
+	// values of secret variables never reach the terminal or the log
+	if err := validateSecrets(p.Pipeline.Secrets); err != nil {
+		fmt.Fprintf(os.Stderr, "pipejob: %v\n", err)
+		return 6
+	}
+	masker := &secretMasker{names: secretNames(p.Pipeline.Secrets), vars: vars}
+	// file/command secrets are loaded lazily, the first time a command
+	// references them; a value set via variables/.env/--var takes precedence
+	pendingSecrets := map[string]SecretSpec{}
+	for _, sp := range p.Pipeline.Secrets {
+		if _, set := vars[sp.Name]; !set && (sp.File != "" || sp.Command != "") {
+			pendingSecrets[sp.Name] = sp
+		}
+	}
+	// loadSecretsFor loads the pending secrets the templates use, directly
+	// or through other variables, and substitutes them into the variables
+	// referencing them. A dry run never loads secrets.
+	var loadSecretsFor func(tmpls ...string) error
+	loadSecretsFor = func(tmpls ...string) error {
+		if dryRun || len(pendingSecrets) == 0 {
+			return nil
+		}
+		for _, t := range tmpls {
+			for _, name := range secretRefs(t, vars, pendingSecrets) {
+				sp, ok := pendingSecrets[name]
+				if !ok {
+					continue // loaded for an earlier template
+				}
+				delete(pendingSecrets, name)
+				// a secret's file or command may use other secrets
+				if err := loadSecretsFor(sp.File, sp.Command); err != nil {
+					return err
+				}
+				if sp.Command != "" {
+					if err := policy.checkCommand(interpolate(sp.Command, vars), "secret "+name); err != nil {
+						return err
+					}
+				}
+				v, err := loadSecret(sp, vars)
+				if err != nil {
+					return err
+				}
+				setSecret(vars, name, v)
+			}
+		}
+		return nil
+	}
+
+	// --print-vars shows the resolved variables and exits without running
+	if printVarsOnly {
+		for name, sp := range pendingSecrets {
+			vars[name] = secretMask
+			if sp.File != "" {
+				varSources[name] = "secret file " + sp.File + " (not loaded)"
+			} else {
+				varSources[name] = "secret command (not loaded)"
+			}
+		}
+		printVars(vars, varSources, masker)
+		return 0
+	}
+
+	if err := policy.checkShell(shellHint); err != nil {
+		fmt.Fprintf(os.Stderr, "pipejob: refusing to run: %v\n", err)
+		return 3
+	}
+	if err := policy.checkVars(varSources); err != nil {
+		fmt.Fprintf(os.Stderr, "pipejob: refusing to run: %v\n", err)
+		return 3
+	}
+	// profile env entries reach every command's environment
+	for name := range profile.Env {
+		if err := policy.checkVar(name, "profile "+profileName+" env"); err != nil {
+			fmt.Fprintf(os.Stderr, "pipejob: refusing to run: %v\n", err)
+			return 3
+		}
+	}
+
+	// in-memory ring buffer keeping the most recent log output (300 KB by
+	// default, --log-buffer-size). This mimics the pipeline's error-evidence
+	// buffer and avoids writing logs to disk on success. With --log-spill
+	// the overflow goes to a temp file so a failed run keeps the full log.
+	logBufferSize := defaultLogBufferSize
+	if logBufferSizeStr != "" {
+		n, err := parseByteSize(logBufferSizeStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --log-buffer-size: %v\n", err)
+			return 2
+		}
+		logBufferSize = n
+	}
+	// The workspace is created now so commands can use {{RUN_DIR}}; it is
+	// removed again when the run succeeds, unless it is a --persist-logs dir.
+	if !dryRun || persistLogs != "" {
 		if err := os.MkdirAll(tempDir, 0755); err != nil {
-			fmt.Fprintf(os.Stderr, "failed to create persist dir %s: %v\n", tempDir, err)
+			fmt.Fprintf(os.Stderr, "failed to create run dir %s: %v\n", tempDir, err)
 			return 2
 		}
 	}
 
-	// in-memory bounded log buffer (ring-like): we keep up to logCap
-	// bytes of the most recent log output. This mimics the pipeline's
-	// error-evidence buffer and avoids writing logs to disk on success.
-	const logCap = 307200 // 300 KB
-	var logBuf []byte
+	logBuf := newRingBuffer(logBufferSize, logSpill && persistLogs == "")
+	defer logBuf.Close()
 	logPath := filepath.Join(tempDir, "run.log")
 	var lf *os.File
 	if persistLogs != "" {
@@ -276,31 +631,33 @@ func RunWithArgs(args []string) (rc int) {
 		defer lf.Close()
 	}
 
-	// appendToBuf appends data to the in-memory buffer and truncates the
-	// front if we exceed the capacity (keep the last logCap bytes).
-	appendToBuf := func(b []byte) {
-		if len(b) == 0 {
-			return
-		}
-		logBuf = append(logBuf, b...)
-		if len(logBuf) > logCap {
-			// keep only the trailing logCap bytes
-			logBuf = logBuf[len(logBuf)-logCap:]
+	// writeLogBytes appends raw bytes to the log; it is shared with the
+	// goroutines copying command output, hence the mutex.
+	var logMu sync.Mutex
+	writeLogBytes := func(b []byte) {
+		logMu.Lock()
+		defer logMu.Unlock()
+		b = []byte(masker.mask(string(b)))
+		logBuf.Write(b)
+		if lf != nil {
+			lf.Write(b)
 		}
 	}
 
 	writeLog := func(s string) {
-		line := []byte(s + "\n")
-		appendToBuf(line)
-		if lf != nil {
-			lf.Write(line)
-		}
+		writeLogBytes([]byte(s + "\n"))
+	}
+
+	// reportErr prints a runner error to stderr and records it in the log.
+	reportErr := func(msg string) {
+		fmt.Fprintln(os.Stderr, masker.mask(msg))
+		writeLog(msg)
 	}
 
 	// Cleanup / persist-on-error behavior: if the run exits non-zero and
-	// the user didn't request `--persist-logs`, create the temp dir and
-	// write the buffered log there so users can inspect failures. If the
-	// run is successful we skip writing logs to avoid unnecessary IO.
+	// the user didn't request `--persist-logs`, write the buffered log to
+	// the workspace so users can inspect failures. If the run is successful
+	// we skip writing logs to avoid unnecessary IO and remove the workspace.
 	defer func() {
 		// If user explicitly requested a persist dir, logs were already
 		// written there and we don't remove them.
@@ -314,370 +671,831 @@ func RunWithArgs(args []string) (rc int) {
 				return
 			}
 			if lf == nil {
-				// write the in-memory buffer to the log file
-				if err := os.WriteFile(logPath, logBuf, 0644); err != nil {
+				// write the in-memory buffer (and spilled overflow) to the log file
+				if err := writeLogFile(logPath, logBuf); err != nil {
 					fmt.Fprintf(os.Stderr, "failed to write log file %s: %v\n", logPath, err)
 				} else {
 					fmt.Fprintf(os.Stderr, "logs written to: %s\n", logPath)
 				}
 			}
+		} else if !dryRun {
+			// successful run: drop the workspace (and .sync_temp if empty)
+			os.RemoveAll(tempDir)
+			os.Remove(tempBase)
 		}
 	}()
 
-	// prepare execution queue (copy pipeline jobs so we can insert resume jobs)
-	execJobs := make([]Job, len(p.Pipeline.Jobs))
-	copy(execJobs, p.Pipeline.Jobs)
+	// runStatus records how the run ended when the exit code alone does not
+	// tell ("dropped", "timeout", "interrupted"); it is exposed to cleanup as
+	// PIPEJOB_STATUS.
+	runStatus := ""
 
-	// iterate jobs and steps
-	for ji := 0; ji < len(execJobs); ji++ {
-		job := &execJobs[ji]
-		// build step index map for goto_step lookups
-		stepIndex := make(map[string]int)
-		for idx, st := range job.Steps {
-			stepIndex[st.Name] = idx
+	// Trap SIGINT/SIGTERM instead of dying: forward the signal to the running
+	// command's process group, SIGKILL it after the kill grace (or on a second
+	// signal), and let the step loop stop at its next check so cleanup runs
+	// and logs are flushed. The run then exits with 128+signal (130/143).
+	var caughtSig atomic.Int32
+	sigCh := make(chan os.Signal, 2)
+	sigDone := make(chan struct{})
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(sigCh)
+		close(sigDone)
+	}()
+	go func() {
+		for {
+			select {
+			case <-sigDone:
+				return
+			case s := <-sigCh:
+				sig, _ := s.(syscall.Signal)
+				if !caughtSig.CompareAndSwap(0, int32(sig)) {
+					// second signal: stop waiting for a graceful exit
+					signalActiveProcess(syscall.SIGKILL)
+					continue
+				}
+				pid := signalActiveProcess(sig)
+				go func() {
+					select {
+					case <-time.After(globalKillGrace):
+						signalProcessIfActive(pid, syscall.SIGKILL)
+					case <-sigDone:
+					}
+				}()
+			}
+		}
+	}()
+	// inCleanup is set once cleanup starts; cleanup commands still run after
+	// a signal was caught.
+	inCleanup := false
+	// interrupted reports the exit code to use once a signal was caught.
+	interrupted := func() (int, bool) {
+		sig := syscall.Signal(caughtSig.Load())
+		if sig == 0 {
+			return 0, false
 		}
+		reportErr(fmt.Sprintf("pipejob: interrupted by signal: %v", sig))
+		runStatus = "interrupted"
+		return 128 + int(sig), true
+	}
 
-		for si := 0; si < len(job.Steps); si++ {
-			step := &job.Steps[si]
+	// compile condition regexes so bad patterns fail before any command runs
+	if err := compileConditions(p.Pipeline.Jobs); err != nil {
+		reportErr(fmt.Sprintf("pipejob: %v", err))
+		return 6
+	}
 
-			// run each command and capture combined output
-			var combinedOut strings.Builder
-			lastExitCode := 0
-			errOccurred := false
-			// parse optional step timeout once per step
-			var stepTimeout time.Duration
-			if step.Timeout != "" {
-				d, perr := time.ParseDuration(step.Timeout)
-				if perr != nil {
-					msg := fmt.Sprintf("invalid timeout '%s' in step %s: %v", step.Timeout, step.Name, perr)
-					fmt.Fprintln(os.Stderr, msg)
-					writeLog(msg)
-					return 6
+	// prepare execution queue (a fresh slice so we can insert resume jobs)
+	runs := p.Pipeline.Runs
+	if len(profile.Jobs) > 0 {
+		runs = profile.Jobs
+	}
+	execJobs, err := buildExecOrder(p.Pipeline.Jobs, runs, selectedJobs)
+	if err != nil {
+		reportErr(fmt.Sprintf("pipejob: %v", err))
+		return 2
+	}
+
+	// resolve pipeline.on_failure up front so a typo fails before any command runs
+	var onFailureSteps []Step
+	if of := p.Pipeline.OnFailure; of != nil {
+		if of.Job != "" {
+			found := false
+			for _, j := range p.Pipeline.Jobs {
+				if j.Name == of.Job {
+					onFailureSteps = append(onFailureSteps, j.Steps...)
+					found = true
+					break
 				}
-				stepTimeout = d
 			}
+			if !found {
+				reportErr(fmt.Sprintf("on_failure job '%s' not found", of.Job))
+				return 6
+			}
+		}
+		onFailureSteps = append(onFailureSteps, of.Steps...)
+	}
 
-			// parse optional idle timeout
-			var stepIdleTimeout time.Duration
-			// step-level idle_timeout takes precedence; otherwise use global default if provided
-			if step.IdleTimeout != "" {
-				d, perr := time.ParseDuration(step.IdleTimeout)
-				if perr != nil {
-					msg := fmt.Sprintf("invalid idle_timeout '%s' in step %s: %v", step.IdleTimeout, step.Name, perr)
-					fmt.Fprintln(os.Stderr, msg)
-					writeLog(msg)
-					return 6
+	// check the queued jobs against the policy before anything runs: jobs
+	// needing --confirm (unless gated by `if`, checked when they start),
+	// including the on_failure and finally jobs, and denied commands, as far
+	// as they can be interpolated now. Commands are checked again right
+	// before they run.
+	policyChecks := func() error {
+		owners := map[string][]Step{}
+		var names []string
+		addSteps := func(owner string, steps []Step) {
+			if _, ok := owners[owner]; !ok {
+				names = append(names, owner)
+			}
+			owners[owner] = append(owners[owner], steps...)
+		}
+		for _, j := range execJobs {
+			if j.If == "" {
+				if err := policy.checkJob(j.Name, confirmed); err != nil {
+					return err
 				}
-				stepIdleTimeout = d
-			} else if defaultIdleTimeoutStr != "" {
-				d, perr := time.ParseDuration(defaultIdleTimeoutStr)
-				if perr != nil {
-					msg := fmt.Sprintf("invalid global --idle-timeout value '%s': %v", defaultIdleTimeoutStr, perr)
-					fmt.Fprintln(os.Stderr, msg)
-					writeLog(msg)
-					return 6
+			}
+			addSteps(j.Name, append(append([]Step{}, j.Steps...), j.Post...))
+		}
+		for _, j := range p.Pipeline.Finally {
+			if j.If == "" {
+				if err := policy.checkJob(j.Name, confirmed); err != nil {
+					return err
+				}
+			}
+			addSteps(j.Name, append(append([]Step{}, j.Steps...), j.Post...))
+		}
+		if of := p.Pipeline.OnFailure; of != nil && of.Job != "" {
+			if err := policy.checkJob(of.Job, confirmed); err != nil {
+				return err
+			}
+		}
+		addSteps("on_failure", onFailureSteps)
+		for _, sp := range p.Pipeline.Secrets {
+			if _, ok := pendingSecrets[sp.Name]; ok && sp.Command != "" {
+				if err := policy.checkCommand(interpolate(sp.Command, vars), "secret "+sp.Name); err != nil {
+					return err
+				}
+			}
+		}
+		for _, owner := range names {
+			for _, st := range owners[owner] {
+				if name := interpolate(st.SaveOutput, vars); name != "" && !strings.Contains(name, "{{") {
+					if err := policy.checkVar(name, "save_output of "+owner+"/"+st.Name); err != nil {
+						return err
+					}
+				}
+				cmds := st.Commands
+				if len(cmds) == 0 && st.Command != "" {
+					cmds = []string{st.Command}
+				}
+				for _, c := range cmds {
+					if err := policy.checkCommand(interpolate(c, vars), owner+"/"+st.Name); err != nil {
+						return err
+					}
 				}
-				stepIdleTimeout = d
 			}
+		}
+		return nil
+	}
+	if err := policyChecks(); err != nil {
+		reportErr(fmt.Sprintf("pipejob: refusing to run: %v", err))
+		return 3
+	}
+
+	// pipeline-wide budget; jobDeadline is set per job in the loop below.
+	// Commands get at most the time left before the nearest deadline.
+	var pipelineDeadline, jobDeadline time.Time
+	p.Pipeline.Timeout = interpolate(p.Pipeline.Timeout, vars)
+	if p.Pipeline.Timeout != "" {
+		d, err := time.ParseDuration(p.Pipeline.Timeout)
+		if err != nil {
+			reportErr(fmt.Sprintf("invalid pipeline timeout '%s': %v", p.Pipeline.Timeout, err))
+			return 6
+		}
+		pipelineDeadline = time.Now().Add(d)
+	}
+
+	// Loop protection: every goto_step/goto_job/call_job counts as a jump
+	// and every step execution as a visit. Exceeding pipeline.max_jumps or a
+	// step's max_visits ends the run with exit code 8.
+	maxJumps := p.Pipeline.MaxJumps
+	if maxJumps == 0 {
+		maxJumps = defaultMaxJumps
+	}
+	jumps := 0
+	// the most recent jumps (at most jumpTrailSize), for loop reports
+	var jumpTrail []string
+	stepVisits := map[string]int{}
 
-			// build command list: `commands` takes priority over `command`
-			var cmds []string
-			if len(step.Commands) > 0 {
-				cmds = step.Commands
-			} else if step.Command != "" {
-				cmds = []string{step.Command}
+	// loopLimitExceeded reports a loop-protection failure together with the
+	// most recent jumps and returns the exit code to use.
+	loopLimitExceeded := func(msg string) int {
+		reportErr(msg)
+		start := jumps - len(jumpTrail)
+		if start > 0 {
+			reportErr(fmt.Sprintf("jump history (last %d of %d):", len(jumpTrail), jumps))
+		} else {
+			reportErr("jump history:")
+		}
+		for i, j := range jumpTrail {
+			reportErr(fmt.Sprintf("  #%d %s", start+i+1, j))
+		}
+		return 8
+	}
+
+	// detoured is set when the current job left through a goto_job/call_job
+	// that will resume it, so its post steps are deferred to the resume job.
+	detoured := false
+	// postStack holds the jobs whose post steps are still owed, innermost
+	// last. Nested call_job/goto_job detours push on top of their caller.
+	var postStack []Job
+	cleanupFailed := false
+	// the step currently (or last) running, reported to on_failure
+	var curJobName, curStepName, curOutput string
+
+	// recordJump adds a jump to the history and enforces pipeline.max_jumps.
+	recordJump := func(job *Job, step *Step, a flowAction, target string) (int, bool) {
+		jumps++
+		if len(jumpTrail) == jumpTrailSize {
+			// drop the oldest entry; with max_jumps < 0 loops may run forever
+			jumpTrail = append(jumpTrail[:0], jumpTrail[1:]...)
+		}
+		jumpTrail = append(jumpTrail, fmt.Sprintf("%s/%s -> %s %s (%s)", job.baseName(), step.Name, a.Action, target, a.Origin))
+		if maxJumps > 0 && jumps > maxJumps {
+			return loopLimitExceeded(fmt.Sprintf("loop protection: more than %d jumps (pipeline.max_jumps)", maxJumps)), true
+		}
+		return 0, false
+	}
+
+	// applyAction performs a control-flow action for `step` of `job` (the
+	// job at execJobs[*ji]). Jumps update the loop indices in place; when the
+	// run must end it returns (rc, true).
+	applyAction := func(a flowAction, job *Job, step *Step, ji, si *int) (int, bool) {
+		switch a.Action {
+		case "continue":
+			// nothing, proceed to the next step
+		case "drop":
+			writeLog(a.Origin + ": drop")
+			runStatus = "dropped"
+			return 0, true
+		case "goto_step":
+			if a.Step == "" {
+				reportErr(fmt.Sprintf("%s goto_step requires '%s' in step %s", a.Origin, a.StepField, step.Name))
+				return 6, true
+			}
+			if code, done := recordJump(job, step, a, a.Step); done {
+				return code, true
+			}
+			idx := stepIndexOf(job.Steps, a.Step)
+			if idx < 0 {
+				reportErr(fmt.Sprintf("%s goto_step target '%s' not found in job %s", a.Origin, a.Step, job.Name))
+				return 6, true
+			}
+			*si = idx - 1 // -1 because the step loop will increment
+		case "goto_job", "call_job":
+			if a.Job == "" {
+				reportErr(fmt.Sprintf("%s %s requires '%s' in step %s", a.Origin, a.Action, a.JobField, step.Name))
+				return 6, true
+			}
+			if code, done := recordJump(job, step, a, a.Job); done {
+				return code, true
+			}
+			var found int
+			var ok bool
+			if a.Action == "call_job" {
+				found, ok = insertCallJob(&execJobs, p.Pipeline.Jobs, a.Job, *ji)
 			} else {
-				// nothing to run in this step
-				continue
+				found, ok = resolveJobIndexExec(&execJobs, p.Pipeline.Jobs, a.Job, *ji)
+			}
+			if !ok {
+				reportErr(fmt.Sprintf("%s %s target '%s' not found", a.Origin, a.Action, a.Job))
+				return 6, true
+			}
+			// call_job always returns to the remaining steps; goto_job does
+			// too unless `resume: false` asks for a permanent transfer
+			if !a.NoResume && (a.Action == "call_job" || a.Resume == nil || *a.Resume) {
+				detoured = insertResumeJob(&execJobs, found, *job, *si)
+				// the caller's timeout keeps running during the detour
+				caller := *job
+				execJobs[found].caller = &caller
+			}
+			*ji = found - 1 // outer loop will increment
+			// exit current job's steps immediately
+			*si = len(job.Steps)
+		case "fail":
+			var msg string
+			switch a.Origin {
+			case "on_timeout":
+				msg = fmt.Sprintf("step %s timed out", step.Name)
+				runStatus = "timeout"
+			case "else_action":
+				msg = fmt.Sprintf("step %s failed due to else_action", step.Name)
+			default:
+				msg = fmt.Sprintf("step %s failed due to %s match", step.Name, a.Origin)
+			}
+			if !(globalSilent || step.Silent) {
+				fmt.Fprintln(os.Stderr, masker.mask(msg))
+			}
+			writeLog(msg)
+			return 7, true
+		default:
+			reportErr(fmt.Sprintf("unknown %s action '%s' in step %s", a.Origin, a.Action, step.Name))
+			return 6, true
+		}
+		return 0, false
+	}
+
+	// prepareStep sets {{JOB_NAME}}/{{STEP_NAME}} and returns a copy of
+	// step with its fields interpolated, so e.g. `timeout: "{{T}}"` can be
+	// tuned with --var.
+	prepareStep := func(jobName string, step *Step) (*Step, error) {
+		vars["JOB_NAME"], vars["STEP_NAME"] = jobName, step.Name
+		// secrets used by the commands are loaded when each one runs
+		if err := loadSecretsFor(fieldStrings(*step, commandFields)...); err != nil {
+			return nil, err
+		}
+		// inputs of a `uses` action only known now
+		for _, c := range step.inputChecks {
+			if err := loadSecretsFor(c.value); err != nil {
+				return nil, err
+			}
+			if err := c.check(vars); err != nil {
+				return nil, err
+			}
+		}
+		st := interpolateStep(*step, vars)
+		return &st, nil
+	}
+
+	// setExports sets the outputs of a `uses` action after its last step
+	setExports := func(step *Step) {
+		for name, tmpl := range step.exports {
+			vars[name] = interpolate(tmpl, vars)
+		}
+	}
+
+	// runStepCommands runs the command(s) of a step of job `jobName`,
+	// echoing and logging them, and stores the output when `save_output` is
+	// set. Command output always goes to the log, prefixed with a timestamp
+	// and job/step; `silent` only affects the terminal. Invalid step
+	// settings are returned as an error.
+	runStepCommands := func(jobName string, step *Step) (stepResult, error) {
+		// run each command and capture combined output
+		var combinedOut strings.Builder
+		lastExitCode := 0
+		errOccurred := false
+		// parse optional step timeout once per step
+		var stepTimeout time.Duration
+		if step.Timeout != "" {
+			d, perr := time.ParseDuration(step.Timeout)
+			if perr != nil {
+				return stepResult{}, fmt.Errorf("invalid timeout '%s' in step %s: %v", step.Timeout, step.Name, perr)
+			}
+			stepTimeout = d
+		}
+		// the step timeout is a single deadline for the whole `commands`
+		// sequence unless timeout_per_command gives each command the full
+		// timeout
+		var stepDeadline time.Time
+		if stepTimeout > 0 && !step.TimeoutPerCommand {
+			stepDeadline = time.Now().Add(stepTimeout)
+		}
+
+		// parse optional idle timeout
+		var stepIdleTimeout time.Duration
+		// step-level idle_timeout takes precedence; otherwise use global default if provided
+		if step.IdleTimeout != "" {
+			d, perr := time.ParseDuration(step.IdleTimeout)
+			if perr != nil {
+				return stepResult{}, fmt.Errorf("invalid idle_timeout '%s' in step %s: %v", step.IdleTimeout, step.Name, perr)
+			}
+			stepIdleTimeout = d
+		} else if defaultIdleTimeoutStr != "" {
+			d, perr := time.ParseDuration(defaultIdleTimeoutStr)
+			if perr != nil {
+				return stepResult{}, fmt.Errorf("invalid global --idle-timeout value '%s': %v", defaultIdleTimeoutStr, perr)
+			}
+			stepIdleTimeout = d
+		}
+
+		// termination on timeout: step-level kill_signal/kill_grace take
+		// precedence over the global --kill-signal/--kill-grace
+		killSignal := globalKillSignal
+		if step.KillSignal != "" {
+			sig, perr := parseSignal(step.KillSignal)
+			if perr != nil {
+				return stepResult{}, fmt.Errorf("invalid kill_signal in step %s: %v", step.Name, perr)
+			}
+			killSignal = sig
+		}
+		killGrace := globalKillGrace
+		if step.KillGrace != "" {
+			d, perr := time.ParseDuration(step.KillGrace)
+			if perr != nil {
+				return stepResult{}, fmt.Errorf("invalid kill_grace '%s' in step %s: %v", step.KillGrace, step.Name, perr)
 			}
+			killGrace = d
+		}
+
+		// build command list: `commands` takes priority over `command`
+		var cmds []string
+		if len(step.Commands) > 0 {
+			cmds = step.Commands
+		} else if step.Command != "" {
+			cmds = []string{step.Command}
+		} else {
+			// nothing to run in this step; outputs of a `uses` action ending
+			// with it are still set
+			setExports(step)
+			return stepResult{}, nil
+		}
 
-			for _, c := range cmds {
-				rc := interpolate(c, vars)
-				// Always print the command being executed so runs are traceable;
-				// `silent` only hides the command output (stdout/stderr) and
-				// inline per-step error messages, not the command itself.
-				fmt.Printf("-> %s\n", rc)
-				writeLog("CMD: " + rc)
-				if dryRun {
-					// skip execution in dry-run mode
+		// fail_fast stops at the first failing command; it defaults to on
+		// for pipeline schema version 2 and later
+		failFast := p.Pipeline.Version >= 2
+		if step.FailFast != nil {
+			failFast = *step.FailFast
+		}
+		var exitCodes []int
+		expired := ""
+
+	CMDS:
+		for _, c := range cmds {
+			if caughtSig.Load() != 0 && !inCleanup {
+				// interrupted: don't start further commands
+				break
+			}
+			// the command gets at most the time left before the step, job and
+			// pipeline deadlines (cleanup is not bound by the job and
+			// pipeline budgets)
+			var cmdTimeout time.Duration
+			if step.TimeoutPerCommand {
+				cmdTimeout = stepTimeout
+			}
+			limitedBy := ""
+			budgets := []budget{{"step", stepDeadline}}
+			if !inCleanup {
+				budgets = append(budgets, budget{"job", jobDeadline}, budget{"pipeline", pipelineDeadline})
+			}
+			for _, b := range budgets {
+				if b.deadline.IsZero() {
 					continue
 				}
-				// capture output
-				var outBuf bytes.Buffer
-				exitCode, err := runLocalCommandExec(rc, stepTimeout, stepIdleTimeout, &outBuf, &outBuf)
-				lastExitCode = exitCode
-				if err != nil {
-					msg := fmt.Sprintf("command failed: %v", err)
-					if !(globalSilent || step.Silent) {
-						fmt.Fprintln(os.Stderr, msg)
+				left := time.Until(b.deadline)
+				if left <= 0 {
+					lastExitCode, errOccurred = 124, true
+					if b.name == "step" {
+						writeLog(fmt.Sprintf("step %s timeout (%s) exhausted before command: %s", step.Name, step.Timeout, c))
+					} else {
+						expired = b.name
 					}
-					writeLog(msg)
-					// don't immediately return: allow conditions to inspect exit code
-					errOccurred = true
+					break CMDS
+				}
+				if cmdTimeout == 0 || left < cmdTimeout {
+					cmdTimeout, limitedBy = left, b.name
+				}
+			}
+			// load the secrets this command uses. A dry run never loads
+			// them and shows *** instead.
+			if err := loadSecretsFor(c); err != nil {
+				return stepResult{}, err
+			}
+			cmdVars := vars
+			if names := secretRefs(c, vars, pendingSecrets); dryRun && len(names) > 0 {
+				cmdVars = make(map[string]string, len(vars))
+				for k, v := range vars {
+					cmdVars[k] = v
 				}
-				combinedOut.Write(outBuf.Bytes())
-				// still echo to stdout for user visibility (unless silenced)
+				for _, name := range names {
+					setSecret(cmdVars, name, secretMask)
+				}
+			}
+			rc := interpolate(c, cmdVars)
+			if err := policy.checkCommand(rc, jobName+"/"+step.Name); err != nil {
+				return stepResult{}, err
+			}
+			// Always print the command being executed so runs are traceable;
+			// `silent` only hides the command output (stdout/stderr) and
+			// inline per-step error messages, not the command itself.
+			fmt.Printf("-> %s\n", masker.mask(rc))
+			writeLog("CMD: " + rc)
+			if dryRun {
+				// skip execution in dry-run mode
+				continue
+			}
+			// profile env values may use secrets as well
+			for _, v := range profile.Env {
+				if err := loadSecretsFor(v); err != nil {
+					return stepResult{}, err
+				}
+			}
+			// capture output, and log it line by line as it arrives
+			var outBuf bytes.Buffer
+			logOut := newLinePrefixWriter(jobName+"/"+step.Name, writeLogBytes)
+			cmdOut := io.MultiWriter(&outBuf, logOut)
+			exitCode, err := runLocalCommandExec(rc, commandOptions{
+				Timeout:     cmdTimeout,
+				IdleTimeout: stepIdleTimeout,
+				KillSignal:  killSignal,
+				KillGrace:   killGrace,
+				Env:         append(builtinEnv(vars), profileEnv(profile, vars)...),
+			}, cmdOut, cmdOut)
+			logOut.Flush()
+			lastExitCode = exitCode
+			exitCodes = append(exitCodes, exitCode)
+			if err != nil {
+				msg := fmt.Sprintf("command failed: %v", err)
 				if !(globalSilent || step.Silent) {
-					os.Stdout.Write(outBuf.Bytes())
+					fmt.Fprintln(os.Stderr, masker.mask(msg))
+				}
+				writeLog(msg)
+				// don't immediately return: allow conditions to inspect exit code
+				errOccurred = true
+			}
+			combinedOut.Write(outBuf.Bytes())
+			// still echo to stdout for user visibility (unless silenced)
+			if !(globalSilent || step.Silent) {
+				os.Stdout.WriteString(masker.mask(outBuf.String()))
+			}
+			if te, ok := err.(*timeoutError); ok && te.Reason == "timeout" && (limitedBy == "job" || limitedBy == "pipeline") {
+				expired = limitedBy
+				break
+			}
+			if err != nil && failFast {
+				writeLog(fmt.Sprintf("fail_fast: skipping remaining commands of step %s", step.Name))
+				break
+			}
+		}
+
+		outStr := combinedOut.String()
+		// save output if requested
+		if step.SaveOutput != "" {
+			if err := policy.checkVar(step.SaveOutput, "save_output of "+jobName+"/"+step.Name); err != nil {
+				return stepResult{}, err
+			}
+			vars[step.SaveOutput] = strings.TrimSpace(outStr)
+		}
+		setExports(step)
+		// per-command exit codes, e.g. {{step.exit_codes}} -> "0,1"
+		codeStrs := make([]string, len(exitCodes))
+		for i, ec := range exitCodes {
+			codeStrs[i] = strconv.Itoa(ec)
+		}
+		vars["step.exit_codes"] = strings.Join(codeStrs, ",")
+		vars["step.exit_code"] = strconv.Itoa(lastExitCode)
+		return stepResult{out: outStr, exitCode: lastExitCode, exitCodes: exitCodes, failed: errOccurred, ran: true, expired: expired}, nil
+	}
+
+	// runCleanupSteps runs job `post` steps and `finally` jobs. Failures are
+	// logged but never stop the remaining cleanup, and conditions/when are
+	// not evaluated. It reports whether every step succeeded.
+	runCleanupSteps := func(owner string, steps []Step) bool {
+		ok := true
+		for i := range steps {
+			st, err := prepareStep(owner, &steps[i])
+			if err != nil {
+				reportErr(err.Error())
+				ok = false
+				continue
+			}
+			res, err := runStepCommands(owner, st)
+			if err != nil {
+				reportErr(err.Error())
+				ok = false
+				continue
+			}
+			if res.failed {
+				reportErr(fmt.Sprintf("cleanup step %s/%s failed (exit %d)", owner, steps[i].Name, res.exitCode))
+				ok = false
+			}
+		}
+		return ok
+	}
+
+	// runPost runs the post steps owed by `job` (or by the job a resume job
+	// continues) if they are on top of postStack.
+	runPost := func(job Job) {
+		n := len(postStack)
+		if n == 0 || postStack[n-1].Name != job.baseName() {
+			return
+		}
+		owner := postStack[n-1]
+		postStack = postStack[:n-1]
+		// post steps are cleanup: they are not bound by the job's budget,
+		// which may already be used up (a timeout with on_timeout: continue)
+		jobDeadline = time.Time{}
+		if !runCleanupSteps(owner.Name+" post", owner.Post) {
+			cleanupFailed = true
+		}
+	}
+
+	// Cleanup runs on every exit path once jobs start: pipeline.on_failure
+	// (failing runs only), post steps of jobs interrupted by an early return,
+	// then the finally jobs. The outcome is exposed as {{PIPEJOB_STATUS}}
+	// (success, failed, dropped, timeout, interrupted, policy) and
+	// {{PIPEJOB_EXIT_CODE}}; until then, post steps of jobs that finish
+	// normally see "running" and 0. A failing cleanup turns a successful run
+	// into exit code 5. Registered after the log defer so it runs first.
+	vars["PIPEJOB_STATUS"], vars["PIPEJOB_EXIT_CODE"] = "running", "0"
+	defer func() {
+		inCleanup = true
+		status := runStatus
+		if status == "" {
+			status = "success"
+			if rc != 0 {
+				status = "failed"
+			}
+		}
+		vars["PIPEJOB_STATUS"] = status
+		vars["PIPEJOB_EXIT_CODE"] = strconv.Itoa(rc)
+		if rc != 0 && len(onFailureSteps) > 0 {
+			vars["FAILED_JOB"] = curJobName
+			vars["FAILED_STEP"] = curStepName
+			vars["EXIT_CODE"] = strconv.Itoa(rc)
+			vars["FAILED_OUTPUT"] = tailLines(curOutput, failedOutputLines)
+			writeLog("on_failure: running")
+			runCleanupSteps("on_failure", onFailureSteps)
+		}
+		for len(postStack) > 0 {
+			runPost(postStack[len(postStack)-1])
+		}
+		for _, fj := range p.Pipeline.Finally {
+			if err := loadSecretsFor(fj.If); err != nil {
+				reportErr(err.Error())
+				cleanupFailed = true
+				continue
+			}
+			if fj.If != "" && !evalIfExpr(fj.If, vars) {
+				writeLog(fmt.Sprintf("skipping finally job %s (if: %s)", fj.Name, fj.If))
+				continue
+			}
+			if err := policy.checkJob(fj.Name, confirmed); err != nil {
+				reportErr(fmt.Sprintf("pipejob: skipping finally job %s: %v", fj.Name, err))
+				if rc == 0 {
+					rc = 3
 				}
+				continue
 			}
+			writeLog("finally: " + fj.Name)
+			if !runCleanupSteps(fj.Name, append(append([]Step{}, fj.Steps...), fj.Post...)) {
+				cleanupFailed = true
+			}
+		}
+		if cleanupFailed && rc == 0 {
+			rc = 5
+		}
+	}()
 
-			outStr := combinedOut.String()
-			// save output if requested
-			if step.SaveOutput != "" {
-				vars[step.SaveOutput] = strings.TrimSpace(outStr)
+	// iterate jobs and steps
+	for ji := 0; ji < len(execJobs); ji++ {
+		// work on a copy: inserting jobs may shift the entries of execJobs
+		job := execJobs[ji]
+		// conditional jobs are evaluated right before their first step so
+		// they can see outputs saved by earlier jobs
+		if err := loadSecretsFor(fieldStrings(job, nil)...); err != nil {
+			reportErr(err.Error())
+			if _, ok := err.(*policyError); ok {
+				runStatus = "policy"
+				return 3
+			}
+			return 6
+		}
+		if job.If != "" && !evalIfExpr(job.If, vars) {
+			msg := fmt.Sprintf("skipping job %s (if: %s)", job.Name, job.If)
+			fmt.Println(masker.mask(msg))
+			writeLog(msg)
+			continue
+		}
+		job = interpolateJob(job, vars)
+		if err := policy.checkJob(job.baseName(), confirmed); err != nil {
+			reportErr(fmt.Sprintf("pipejob: %v", err))
+			runStatus = "policy"
+			return 3
+		}
+		if job.resumeOf == "" && len(job.Post) > 0 {
+			postStack = append(postStack, job)
+		}
+		if job.deadline.IsZero() && job.Timeout != "" {
+			d, err := time.ParseDuration(job.Timeout)
+			if err != nil {
+				reportErr(fmt.Sprintf("invalid timeout '%s' in job %s: %v", job.Timeout, job.Name, err))
+				return 6
+			}
+			job.deadline = time.Now().Add(d)
+		}
+		// a detour is also bound by the timeout of the job it returns to
+		budgetJob := job.budgetJob()
+		jobDeadline = budgetJob.deadline
+		detoured = false
+		for si := 0; si < len(job.Steps); si++ {
+			step := &job.Steps[si]
+
+			visitKey := job.baseName() + "/" + step.Name
+			stepVisits[visitKey]++
+			if step.MaxVisits > 0 && stepVisits[visitKey] > step.MaxVisits {
+				return loopLimitExceeded(fmt.Sprintf("loop protection: step %s ran more than %d times (max_visits)", visitKey, step.MaxVisits))
 			}
 
+			if code, stop := interrupted(); stop {
+				return code
+			}
+			curJobName, curStepName, curOutput = job.baseName(), step.Name, ""
+			step, err := prepareStep(job.baseName(), step)
+			if err != nil {
+				reportErr(err.Error())
+				if _, ok := err.(*policyError); ok {
+					runStatus = "policy"
+					return 3
+				}
+				return 6
+			}
+			res, err := runStepCommands(job.baseName(), step)
+			if err != nil {
+				reportErr(err.Error())
+				if _, ok := err.(*policyError); ok {
+					runStatus = "policy"
+					return 3
+				}
+				return 6
+			}
+			curOutput = res.out
+			if code, stop := interrupted(); stop {
+				return code
+			}
+			if res.expired == "pipeline" {
+				reportErr(fmt.Sprintf("pipeline timeout (%s) exceeded in step %s/%s", p.Pipeline.Timeout, job.baseName(), step.Name))
+				runStatus = "timeout"
+				return 7
+			}
+			if res.expired == "job" {
+				tj := budgetJob
+				writeLog(fmt.Sprintf("job %s timed out after %s in step %s/%s", tj.baseName(), tj.Timeout, job.baseName(), step.Name))
+				if tj.OnTimeout == "" || tj.OnTimeout == "fail" {
+					reportErr(fmt.Sprintf("job %s timed out after %s", tj.baseName(), tj.Timeout))
+					runStatus = "timeout"
+					return 7
+				}
+				if tj != &job {
+					// a caller timed out during the detour: it is not resumed
+					removeResumeJobs(&execJobs, ji, tj.baseName())
+				}
+				switch tj.OnTimeout {
+				case "continue":
+					// proceed with the next job
+				case "drop":
+					writeLog("job on_timeout: drop")
+					runStatus = "dropped"
+					return 0
+				case "goto_job", "call_job":
+					// the timed-out job is never resumed
+					if code, done := applyAction(tj.timeoutFlowAction(), &job, step, &ji, &si); done {
+						return code
+					}
+				default:
+					reportErr(fmt.Sprintf("unknown job on_timeout action '%s' in job %s", tj.OnTimeout, tj.Name))
+					return 6
+				}
+				break
+			}
+			if !res.ran {
+				// nothing to run in this step
+				continue
+			}
+			outStr, lastExitCode, errOccurred := res.out, res.exitCode, res.failed
+			exitCodes := res.exitCodes
+
 			// Evaluate conditions
 			conditionMatched := false
 			// legacy `conditions` (pattern -> action)
 			for _, cond := range step.Conditions {
-				pat := interpolate(cond.Pattern, vars)
-				re, err := regexp.Compile(pat)
+				matched, err := cond.matcher.match(outStr, vars)
 				if err != nil {
-					msg := fmt.Sprintf("invalid condition regex '%s' in step %s: %v", pat, step.Name, err)
-					fmt.Fprintln(os.Stderr, msg)
-					writeLog(msg)
+					reportErr(fmt.Sprintf("invalid condition in step %s: %v", step.Name, err))
 					return 6
 				}
-				if re.MatchString(outStr) {
+				if matched {
 					conditionMatched = true
-					switch cond.Action {
-					case "continue":
-						// do nothing, proceed to next step
-					case "drop":
-						writeLog("condition matched: drop")
-						return 0
-					case "goto_step":
-						if cond.Step == "" {
-							msg := fmt.Sprintf("goto_step requires 'step' in step %s", step.Name)
-							fmt.Fprintln(os.Stderr, msg)
-							writeLog(msg)
-							return 6
-						}
-						idx, ok := stepIndex[cond.Step]
-						if !ok {
-							msg := fmt.Sprintf("goto_step target '%s' not found in job %s", cond.Step, job.Name)
-							fmt.Fprintln(os.Stderr, msg)
-							writeLog(msg)
-							return 6
-						}
-						si = idx - 1 // -1 because loop will increment
-					case "goto_job":
-						if cond.Job == "" {
-							msg := fmt.Sprintf("goto_job requires 'job' in step %s", step.Name)
-							fmt.Fprintln(os.Stderr, msg)
-							writeLog(msg)
-							return 6
-						}
-						// find job index in execJobs
-						found, ok := resolveJobIndexExec(&execJobs, p.Pipeline.Jobs, cond.Job, ji)
-						if !ok {
-							msg := fmt.Sprintf("goto_job target '%s' not found", cond.Job)
-							fmt.Fprintln(os.Stderr, msg)
-							writeLog(msg)
-							return 6
-						}
-						ji = found - 1 // outer loop will increment
-						// insert a resume job so we continue remaining steps after
-						// the target job completes
-						insertResumeJob(&execJobs, found, *job, si)
-						// exit current job's steps immediately
-						si = len(job.Steps)
-					case "fail":
-						msg := fmt.Sprintf("step %s failed due to condition match", step.Name)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
-						return 7
-					default:
-						msg := fmt.Sprintf("unknown condition action '%s' in step %s", cond.Action, step.Name)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
-						return 6
+					if code, done := applyAction(cond.flowAction(), &job, step, &ji, &si); done {
+						return code
+					}
+					// stop evaluating further patterns once control moved elsewhere
+					if cond.Action != "continue" {
+						break
 					}
-					// if we performed goto_job we broke the switch and must break cond loop
 				}
 			}
 
 			// new `when` DSL - simpler operators. Evaluated after legacy conditions.
 			if !conditionMatched {
 				for _, w := range step.When {
-					match, err := evalWhenEntry(w, outStr, lastExitCode, vars)
+					match, err := evalWhenEntry(w, outStr, exitCodes, vars)
 					if err != nil {
-						msg := fmt.Sprintf("invalid when entry in step %s: %v", step.Name, err)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
+						reportErr(fmt.Sprintf("invalid when entry in step %s: %v", step.Name, err))
 						return 6
 					}
 					if match {
 						conditionMatched = true
-						switch w.Action {
-						case "continue":
-						case "drop":
-							writeLog("when matched: drop")
-							return 0
-						case "goto_step":
-							if w.Step == "" {
-								msg := fmt.Sprintf("goto_step requires 'step' in step %s", step.Name)
-								fmt.Fprintln(os.Stderr, msg)
-								writeLog(msg)
-								return 6
-							}
-							idx, ok := stepIndex[w.Step]
-							if !ok {
-								msg := fmt.Sprintf("goto_step target '%s' not found in job %s", w.Step, job.Name)
-								fmt.Fprintln(os.Stderr, msg)
-								writeLog(msg)
-								return 6
-							}
-							si = idx - 1
-						case "goto_job":
-							if w.Job == "" {
-								msg := fmt.Sprintf("goto_job requires 'job' in step %s", step.Name)
-								fmt.Fprintln(os.Stderr, msg)
-								writeLog(msg)
-								return 6
-							}
-							found, ok := resolveJobIndexExec(&execJobs, p.Pipeline.Jobs, w.Job, ji)
-							if !ok {
-								msg := fmt.Sprintf("goto_job target '%s' not found", w.Job)
-								fmt.Fprintln(os.Stderr, msg)
-								writeLog(msg)
-								return 6
-							}
-							ji = found - 1
-							// insert resume job so remaining steps are run after the target
-							insertResumeJob(&execJobs, found, *job, si)
-							// exit current job's steps immediately
-							si = len(job.Steps)
-						case "fail":
-							msg := fmt.Sprintf("step %s failed due to when match", step.Name)
-							fmt.Fprintln(os.Stderr, msg)
-							writeLog(msg)
-							return 7
-						default:
-							msg := fmt.Sprintf("unknown when action '%s' in step %s", w.Action, step.Name)
-							fmt.Fprintln(os.Stderr, msg)
-							writeLog(msg)
-							return 6
+						if code, done := applyAction(w.flowAction(), &job, step, &ji, &si); done {
+							return code
 						}
 						break
 					}
 				}
 			}
 			if !conditionMatched && step.ElseAction != "" {
-				// else_action present; proceed to handle it
-				switch step.ElseAction {
-				case "continue":
-					// nothing
-				case "drop":
-					writeLog("else_action: drop")
-					return 0
-				case "goto_step":
-					if step.ElseStep == "" {
-						msg := fmt.Sprintf("else goto_step requires 'else_step' in step %s", step.Name)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
-						return 6
-					}
-					idx, ok := stepIndex[step.ElseStep]
-					if !ok {
-						msg := fmt.Sprintf("else goto_step target '%s' not found in job %s", step.ElseStep, job.Name)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
-						return 6
-					}
-					si = idx - 1
-				case "goto_job":
-					if step.ElseJob == "" {
-						msg := fmt.Sprintf("else goto_job requires 'else_job' in step %s", step.Name)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
-						return 6
-					}
-					found, ok := resolveJobIndexExec(&execJobs, p.Pipeline.Jobs, step.ElseJob, ji)
-					if !ok {
-						msg := fmt.Sprintf("else goto_job target '%s' not found", step.ElseJob)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
-						return 6
-					}
-					ji = found - 1
-					// insert resume job so remaining steps are run after the target
-					insertResumeJob(&execJobs, found, *job, si)
-					// exit current job's steps immediately
-					si = len(job.Steps)
-				case "fail":
-					msg := fmt.Sprintf("step %s failed due to else_action", step.Name)
-					if !(globalSilent || step.Silent) {
-						fmt.Fprintln(os.Stderr, msg)
-					}
-					writeLog(msg)
-					return 7
-				default:
-					msg := fmt.Sprintf("unknown else_action '%s' in step %s", step.ElseAction, step.Name)
-					fmt.Fprintln(os.Stderr, msg)
-					writeLog(msg)
-					return 6
+				if code, done := applyAction(step.elseFlowAction(), &job, step, &ji, &si); done {
+					return code
 				}
+				// mark else_action as handled so the default non-zero handling doesn't fire
+				conditionMatched = true
 			}
-			// mark else_action as handled so the default non-zero handling doesn't fire
-			conditionMatched = true
 
 			// If a timeout happened and user supplied an on_timeout shortcut, handle it
 			if errOccurred && lastExitCode == 124 && step.OnTimeout != "" && !conditionMatched {
-				switch step.OnTimeout {
-				case "continue":
-					// nothing, proceed
-				case "drop":
-					writeLog("on_timeout: drop")
-					return 0
-				case "goto_step":
-					if step.OnTimeoutStep == "" {
-						msg := fmt.Sprintf("on_timeout goto_step requires 'on_timeout_step' in step %s", step.Name)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
-						return 6
-					}
-					idx, ok := stepIndex[step.OnTimeoutStep]
-					if !ok {
-						msg := fmt.Sprintf("on_timeout goto_step target '%s' not found in job %s", step.OnTimeoutStep, job.Name)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
-						return 6
-					}
-					si = idx - 1
-				case "goto_job":
-					if step.OnTimeoutJob == "" {
-						msg := fmt.Sprintf("on_timeout goto_job requires 'on_timeout_job' in step %s", step.Name)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
-						return 6
-					}
-					found, ok := resolveJobIndexExec(&execJobs, p.Pipeline.Jobs, step.OnTimeoutJob, ji)
-					if !ok {
-						msg := fmt.Sprintf("on_timeout goto_job target '%s' not found", step.OnTimeoutJob)
-						fmt.Fprintln(os.Stderr, msg)
-						writeLog(msg)
-						return 6
-					}
-					ji = found - 1
-					// insert resume job so remaining steps are run after the target
-					insertResumeJob(&execJobs, found, *job, si)
-					// exit current job's steps immediately
-					si = len(job.Steps)
-				case "fail":
-					msg := fmt.Sprintf("step %s timed out", step.Name)
-					if !(globalSilent || step.Silent) {
-						fmt.Fprintln(os.Stderr, msg)
-					}
-					writeLog(msg)
-					return 7
-				default:
-					msg := fmt.Sprintf("unknown on_timeout action '%s' in step %s", step.OnTimeout, step.Name)
-					fmt.Fprintln(os.Stderr, msg)
-					writeLog(msg)
-					return 6
+				if code, done := applyAction(step.timeoutFlowAction(), &job, step, &ji, &si); done {
+					return code
 				}
 				// mark as handled so the default non-zero handling doesn't fire
 				conditionMatched = true
@@ -685,12 +1503,17 @@ func RunWithArgs(args []string) (rc int) {
 
 			// If no condition matched and a command returned non-zero, treat as failure
 			if !conditionMatched && errOccurred {
-				msg := fmt.Sprintf("step %s command(s) returned non-zero exit and no condition matched", step.Name)
-				fmt.Fprintln(os.Stderr, msg)
-				writeLog(msg)
+				reportErr(fmt.Sprintf("step %s command(s) returned non-zero exit and no condition matched", step.Name))
+				if lastExitCode == 124 {
+					runStatus = "timeout"
+				}
 				return 5
 			}
 		}
+		// a detoured job finishes in its resume job
+		if !detoured {
+			runPost(job)
+		}
 	}
 	// On success we avoid printing the log path to prevent confusion when the
 	// temporary workspace is cleaned up. Errors still print messages to stderr.
@@ -699,13 +1522,14 @@ func RunWithArgs(args []string) (rc int) {
 }
 
 // evalWhenEntry recursively evaluates a WhenEntry against the step output
-// and last exit code. It returns (match, error). If an invalid regex is
-// encountered the error is returned so the caller can log and abort.
-func evalWhenEntry(w WhenEntry, outStr string, lastExit int, vars map[string]string) (bool, error) {
+// and the exit codes of the commands that ran. It returns (match, error). If
+// an invalid regex is encountered the error is returned so the caller can
+// log and abort.
+func evalWhenEntry(w WhenEntry, outStr string, exitCodes []int, vars map[string]string) (bool, error) {
 	// Group: all (AND)
 	if len(w.All) > 0 {
 		for _, sub := range w.All {
-			m, err := evalWhenEntry(sub, outStr, lastExit, vars)
+			m, err := evalWhenEntry(sub, outStr, exitCodes, vars)
 			if err != nil {
 				return false, err
 			}
@@ -718,7 +1542,7 @@ func evalWhenEntry(w WhenEntry, outStr string, lastExit int, vars map[string]str
 	// Group: any (OR)
 	if len(w.Any) > 0 {
 		for _, sub := range w.Any {
-			m, err := evalWhenEntry(sub, outStr, lastExit, vars)
+			m, err := evalWhenEntry(sub, outStr, exitCodes, vars)
 			if err != nil {
 				return false, err
 			}
@@ -743,18 +1567,26 @@ func evalWhenEntry(w WhenEntry, outStr string, lastExit int, vars map[string]str
 		return false, nil
 	}
 	if w.Regex != "" {
-		pat := interpolate(w.Regex, vars)
-		re, err := regexp.Compile(pat)
-		if err != nil {
-			return false, err
-		}
-		if re.MatchString(outStr) {
-			return true, nil
-		}
-		return false, nil
+		return w.matcher.match(outStr, vars)
 	}
 	if w.ExitCode != nil {
-		if lastExit == *w.ExitCode {
+		// by default the last command's exit code; command_index selects
+		// another one (negative values count from the end)
+		idx := len(exitCodes) - 1
+		if w.CommandIndex != nil {
+			idx = *w.CommandIndex
+			if idx < 0 {
+				idx += len(exitCodes)
+			}
+		}
+		code := 0
+		if idx >= 0 && idx < len(exitCodes) {
+			code = exitCodes[idx]
+		} else if w.CommandIndex != nil {
+			// the selected command did not run
+			return false, nil
+		}
+		if code == *w.ExitCode {
 			return true, nil
 		}
 		return false, nil
@@ -764,19 +1596,45 @@ func evalWhenEntry(w WhenEntry, outStr string, lastExit int, vars map[string]str
 	return false, nil
 }
 
+// budget is a named deadline limiting how long a command may run.
+type budget struct {
+	name     string
+	deadline time.Time
+}
+
+// stepResult is the outcome of running the command(s) of a step.
+type stepResult struct {
+	out      string // combined output of all commands
+	exitCode int    // exit code of the last command
+	// exitCodes holds the exit code of every command that ran, in order
+	exitCodes []int
+	failed    bool // at least one command returned an error
+	ran       bool // false when the step has nothing to run
+	// expired is "job" or "pipeline" when the step was stopped because
+	// that timeout budget ran out
+	expired string
+}
+
 // insertResumeJob inserts a copy of `job` containing only steps after
 // `resumeFrom` into execJobs immediately after index `after`. The new job
-// has a generated unique name so it will be executed exactly once.
-func insertResumeJob(execJobs *[]Job, after int, job Job, resumeFrom int) {
+// has a generated unique name so it will be executed exactly once. Nothing
+// is inserted (and false returned) when no steps remain.
+func insertResumeJob(execJobs *[]Job, after int, job Job, resumeFrom int) bool {
 	if resumeFrom+1 >= len(job.Steps) {
-		return
+		return false
 	}
 	// copy remaining steps
 	rem := make([]Step, len(job.Steps[resumeFrom+1:]))
 	copy(rem, job.Steps[resumeFrom+1:])
 	newJob := Job{
-		Name:  job.Name + "-resume-" + strconv.FormatInt(time.Now().UnixNano(), 10),
-		Steps: rem,
+		Name:         job.Name + "-resume-" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		Steps:        rem,
+		Timeout:      job.Timeout,
+		OnTimeout:    job.OnTimeout,
+		OnTimeoutJob: job.OnTimeoutJob,
+		resumeOf:     job.baseName(),
+		deadline:     job.deadline,
+		caller:       job.caller,
 	}
 	pos := after + 1
 	if pos < 0 {
@@ -786,6 +1644,19 @@ func insertResumeJob(execJobs *[]Job, after int, job Job, resumeFrom int) {
 		pos = len(*execJobs)
 	}
 	*execJobs = append((*execJobs)[:pos], append([]Job{newJob}, (*execJobs)[pos:]...)...)
+	return true
+}
+
+// removeResumeJobs drops the pending resume jobs of the job named name
+// queued after index `after`.
+func removeResumeJobs(execJobs *[]Job, after int, name string) {
+	kept := (*execJobs)[:after+1]
+	for _, j := range (*execJobs)[after+1:] {
+		if j.resumeOf != name {
+			kept = append(kept, j)
+		}
+	}
+	*execJobs = kept
 }
 
 // parseEnvFile and interpolate were moved to helpers.go during the
@@ -799,13 +1670,24 @@ func insertResumeJob(execJobs *[]Job, after int, job Job, resumeFrom int) {
 // the command line.
 func printHelp() {
 	fmt.Println("Usage: pipejob <job.yaml> [flags]")
+	fmt.Println("       pipejob --help <job.yaml>   (also lists the pipeline's params)")
 	fmt.Println()
 	fmt.Println("Global flags:")
-	fmt.Println("  --env-file PATH      Path to .env file (default: .env)")
+	fmt.Println("  --env-file PATH      Path to a .env file (repeatable, later files win; default: .env)")
+	fmt.Println("  --vars-file PATH     Load variables from a YAML or JSON file (repeatable, later files win)")
+	fmt.Println("  --profile NAME       Use a profile from pipeline.profiles (variables, env, jobs)")
+	fmt.Println("  --confirm            Allow running a protected profile or a policy confirm_jobs job")
+	fmt.Println("  --policy PATH        Safety policy file (default: .pipejob-policy.yaml if present)")
+	fmt.Println("  --print-vars         Print every variable's final value and source, then exit")
 	fmt.Println("  --var KEY=VAL        Set a variable (repeatable). Flags can appear anywhere")
+	fmt.Println("  --job NAME           Run only the named job(s) (repeatable); manual jobs included")
 	fmt.Println("  --dry-run            Render commands without executing them")
 	fmt.Println("  --persist-logs DIR   Stream logs live to DIR (keeps logs)")
+	fmt.Println("  --log-buffer-size N  In-memory log size flushed on error (e.g. 300K, 1M; default: 300K)")
+	fmt.Println("  --log-spill          Spill log overflow to a temp file so run.log is complete on error")
 	fmt.Println("  --idle-timeout D     Global idle timeout for steps with no output (Go duration, e.g. 2s). Step-level idle_timeout overrides this. Default: 0s (disabled)")
+	fmt.Println("  --kill-signal SIG    Signal sent first when a step times out (default: SIGKILL). Step-level kill_signal overrides this")
+	fmt.Println("  --kill-grace D       Wait after the kill signal (or a forwarded Ctrl-C) before SIGKILL (default: 5s)")
 	fmt.Println("  --shell <sh|cmd|powershell>  Override shell used to run commands")
 	fmt.Println("  --silent             Suppress per-step prints (command lines and stdout/stderr echoes)")
 	fmt.Println()
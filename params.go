@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// paramTypes are the accepted values of a parameter's `type`.
+var paramTypes = map[string]bool{"string": true, "int": true, "bool": true, "enum": true, "duration": true}
+
+// validateParamDefs checks the `params` declarations themselves (types,
+// enum values, defaults) before any input is looked at.
+func validateParamDefs(params []Param) error {
+	seen := map[string]bool{}
+	for i, pr := range params {
+		if pr.Name == "" {
+			return fmt.Errorf("params entry %d has no name", i+1)
+		}
+		if seen[pr.Name] {
+			return fmt.Errorf("param %s is declared twice", pr.Name)
+		}
+		seen[pr.Name] = true
+		if !paramTypes[pr.paramType()] {
+			return fmt.Errorf("param %s: unknown type '%s' (use string, int, bool, enum or duration)", pr.Name, pr.Type)
+		}
+		if pr.paramType() == "enum" && len(pr.Values) == 0 {
+			return fmt.Errorf("param %s: enum needs a list of values", pr.Name)
+		}
+		if pr.Default != nil {
+			if _, err := pr.check(*pr.Default); err != nil {
+				return fmt.Errorf("param %s: invalid default: %v", pr.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// paramType returns the declared type, "string" when omitted.
+func (pr Param) paramType() string {
+	if pr.Type == "" {
+		return "string"
+	}
+	return strings.ToLower(pr.Type)
+}
+
+// check validates v against the parameter type and returns it normalized
+// (bools become "true"/"false").
+func (pr Param) check(v string) (string, error) {
+	switch pr.paramType() {
+	case "int":
+		if _, err := strconv.Atoi(strings.TrimSpace(v)); err != nil {
+			return "", fmt.Errorf("'%s' is not an integer", v)
+		}
+		return strings.TrimSpace(v), nil
+	case "bool":
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "1", "yes", "on":
+			return "true", nil
+		case "false", "0", "no", "off":
+			return "false", nil
+		}
+		return "", fmt.Errorf("'%s' is not a boolean (true/false)", v)
+	case "enum":
+		for _, allowed := range pr.Values {
+			if v == allowed {
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("'%s' is not one of %s", v, strings.Join(pr.Values, ", "))
+	case "duration":
+		if _, err := time.ParseDuration(strings.TrimSpace(v)); err != nil {
+			return "", fmt.Errorf("'%s' is not a duration (e.g. 30s, 5m)", v)
+		}
+		return strings.TrimSpace(v), nil
+	}
+	return v, nil
+}
+
+// paramDefaults returns the declared default values.
+func paramDefaults(params []Param) map[string]string {
+	out := map[string]string{}
+	for _, pr := range params {
+		if pr.Default != nil {
+			out[pr.Name] = *pr.Default
+		}
+	}
+	return out
+}
+
+// checkParams validates the final variable values against the declared
+// parameters: required ones must be set and every value must match its
+// type. Values are normalized in place.
+func checkParams(params []Param, vars map[string]string) error {
+	var problems []string
+	for _, pr := range params {
+		v, ok := vars[pr.Name]
+		if !ok {
+			if pr.Required {
+				problems = append(problems, fmt.Sprintf("missing required param %s (--var %s=...)", pr.Name, pr.Name))
+			}
+			continue
+		}
+		nv, err := pr.check(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("param %s: %v", pr.Name, err))
+			continue
+		}
+		vars[pr.Name] = nv
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// unknownVarError reports a --var key that is neither a declared param nor
+// a variable from another source, suggesting the closest param name.
+func unknownVarError(key string, params []Param) error {
+	best, bestDist := "", 3
+	for _, pr := range params {
+		if d := editDistance(strings.ToUpper(key), strings.ToUpper(pr.Name)); d < bestDist {
+			best, bestDist = pr.Name, d
+		}
+	}
+	if best != "" {
+		return fmt.Errorf("unknown variable '%s' in --var (did you mean %s?)", key, best)
+	}
+	return fmt.Errorf("unknown variable '%s' in --var (not a declared param or variable)", key)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// printParams lists a pipeline's parameters for `pipejob --help job.yaml`.
+func printParams(name string, params []Param) {
+	fmt.Println()
+	if len(params) == 0 {
+		fmt.Printf("Pipeline %s declares no params.\n", name)
+		return
+	}
+	fmt.Printf("Params of pipeline %s (set with --var NAME=VALUE):\n", name)
+	for _, pr := range params {
+		typ := pr.paramType()
+		if typ == "enum" {
+			typ = "enum: " + strings.Join(pr.Values, "|")
+		}
+		var attrs []string
+		if pr.Required {
+			attrs = append(attrs, "required")
+		}
+		if pr.Default != nil {
+			attrs = append(attrs, fmt.Sprintf("default: %q", *pr.Default))
+		}
+		line := fmt.Sprintf("  %-20s %s", pr.Name, typ)
+		if len(attrs) > 0 {
+			line += " (" + strings.Join(attrs, ", ") + ")"
+		}
+		fmt.Println(line)
+		if pr.Description != "" {
+			fmt.Printf("  %-20s %s\n", "", pr.Description)
+		}
+	}
+}
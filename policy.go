@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// policyFileName is looked up in the working directory, then next to the
+// pipeline file, unless --policy names a file.
+const policyFileName = ".pipejob-policy.yaml"
+
+// Policy restricts what a pipeline may do. Violations stop the run with
+// exit code 3. Without a policy file only execution.mode=live is denied.
+type Policy struct {
+	// DeniedCommands are regexes matched against every command after
+	// interpolation.
+	DeniedCommands []string `yaml:"denied_commands,omitempty"`
+	// AllowedShells limits --shell (sh, cmd, powershell); empty allows all.
+	AllowedShells []string `yaml:"allowed_shells,omitempty"`
+	// ConfirmJobs are job names (globs allowed) that only run with --confirm.
+	ConfirmJobs []string `yaml:"confirm_jobs,omitempty"`
+	// ForbiddenVariables are variable names (globs allowed) that no source
+	// may set.
+	ForbiddenVariables []string `yaml:"forbidden_variables,omitempty"`
+	// DeniedExecutionModes are refused values of `execution.mode`. When
+	// omitted it defaults to [live]; set [] to allow every mode.
+	DeniedExecutionModes []string `yaml:"denied_execution_modes,omitempty"`
+
+	path   string           // file the policy came from ("" = built-in)
+	denied []*regexp.Regexp // compiled DeniedCommands
+}
+
+// policyError is a policy violation; RunWithArgs exits with code 3.
+type policyError struct {
+	source string
+	msg    string
+}
+
+func (e *policyError) Error() string {
+	return fmt.Sprintf("policy violation (%s): %s", e.source, e.msg)
+}
+
+// loadPolicy reads the policy from `explicit` (--policy) or the default
+// locations. A missing default file yields the built-in policy.
+func loadPolicy(explicit, yamlDir string) (*Policy, error) {
+	candidates := []string{policyFileName, filepath.Join(yamlDir, policyFileName)}
+	if explicit != "" {
+		candidates = []string{explicit}
+	}
+	for _, c := range candidates {
+		b, err := os.ReadFile(c)
+		if os.IsNotExist(err) && explicit == "" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pol := &Policy{path: c}
+		if err := yaml.Unmarshal(b, pol); err != nil {
+			return nil, fmt.Errorf("%s: %v", c, err)
+		}
+		if err := pol.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %v", c, err)
+		}
+		return pol, nil
+	}
+	pol := &Policy{}
+	return pol, pol.compile()
+}
+
+func (pol *Policy) compile() error {
+	if pol.DeniedExecutionModes == nil {
+		pol.DeniedExecutionModes = []string{"live"}
+	}
+	for _, pat := range pol.DeniedCommands {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return fmt.Errorf("invalid denied_commands regex '%s': %v", pat, err)
+		}
+		pol.denied = append(pol.denied, re)
+	}
+	return nil
+}
+
+func (pol *Policy) violation(format string, args ...interface{}) error {
+	src := pol.path
+	if src == "" {
+		src = "built-in policy"
+	}
+	return &policyError{source: src, msg: fmt.Sprintf(format, args...)}
+}
+
+// checkExecutionMode refuses a denied `execution.mode`.
+func (pol *Policy) checkExecutionMode(mode string) error {
+	for _, m := range pol.DeniedExecutionModes {
+		if mode != "" && strings.EqualFold(mode, m) {
+			return pol.violation("execution.mode=%s is not allowed", mode)
+		}
+	}
+	return nil
+}
+
+// checkShell refuses a shell not in allowed_shells. An empty shell means
+// the platform default.
+func (pol *Policy) checkShell(shell string) error {
+	if len(pol.AllowedShells) == 0 {
+		return nil
+	}
+	if shell == "" {
+		shell = "sh"
+		if runtime.GOOS == "windows" {
+			shell = "cmd"
+		}
+	}
+	for _, s := range pol.AllowedShells {
+		if strings.EqualFold(s, shell) {
+			return nil
+		}
+	}
+	return pol.violation("shell '%s' is not allowed (allowed: %s)", shell, strings.Join(pol.AllowedShells, ", "))
+}
+
+// checkVars refuses forbidden variables set by any source other than the
+// built-ins.
+func (pol *Policy) checkVars(sources map[string]string) error {
+	for name, src := range sources {
+		if src == "built-in" {
+			continue
+		}
+		if err := pol.checkVar(name, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkVar refuses a forbidden variable name set by src (a variable
+// source, a profile env entry or a step's save_output).
+func (pol *Policy) checkVar(name, src string) error {
+	for _, pat := range pol.ForbiddenVariables {
+		if ok, _ := path.Match(pat, name); ok {
+			return pol.violation("variable %s (from %s) is forbidden", name, src)
+		}
+	}
+	return nil
+}
+
+// needsConfirm reports whether job must be confirmed with --confirm.
+func (pol *Policy) needsConfirm(job string) bool {
+	for _, pat := range pol.ConfirmJobs {
+		if ok, _ := path.Match(pat, job); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkJob refuses an unconfirmed job listed in confirm_jobs.
+func (pol *Policy) checkJob(job string, confirmed bool) error {
+	if !confirmed && pol.needsConfirm(job) {
+		return pol.violation("job %s requires --confirm", job)
+	}
+	return nil
+}
+
+// checkCommand refuses a command matching a denied_commands regex.
+func (pol *Policy) checkCommand(cmd, where string) error {
+	for i, re := range pol.denied {
+		if re.MatchString(cmd) {
+			return pol.violation("command in %s matches denied pattern '%s': %s", where, pol.DeniedCommands[i], cmd)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// profileNames returns the declared profile names, sorted, for messages.
+func profileNames(profiles map[string]Profile) string {
+	if len(profiles) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(profiles))
+	for n := range profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// profileEnv returns the profile's env entries as KEY=VALUE pairs, with
+// {{VAR}} placeholders in the values interpolated.
+func profileEnv(pr Profile, vars map[string]string) []string {
+	keys := make([]string, 0, len(pr.Env))
+	for k := range pr.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, k+"="+interpolate(pr.Env[k], vars))
+	}
+	return env
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinVariables(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: builtins
+  variables:
+    TAG: "{{PIPELINE_NAME}}-{{PIPEJOB_RUN_ID}}"
+  jobs:
+    - name: build
+      steps:
+        - name: show
+          type: command
+          commands:
+            - echo "TPL {{PIPELINE_NAME}} {{JOB_NAME}}/{{STEP_NAME}} {{YAML_DIR}}"
+            - echo "ENV $PIPELINE_NAME $JOB_NAME/$STEP_NAME $YAML_DIR"
+            - echo "TAG {{TAG}}"
+            - test -d "{{RUN_DIR}}" && echo "RUN_DIR_EXISTS"
+            - test -n "$PIPEJOB_RUN_ID" -a -n "$START_TIME" && echo "IDS_SET"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	runDir := filepath.Join(tmp, "run")
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", runDir}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	for _, want := range []string{
+		"TPL builtins build/show " + tmp,
+		"ENV builtins build/show " + tmp,
+		"TAG builtins-2",
+		"RUN_DIR_EXISTS",
+		"IDS_SET",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+
+	// run-scoped built-ins can be overridden
+	out = captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", runDir, "--var", "PIPELINE_NAME=custom"}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "ENV custom build/show") {
+		t.Fatalf("expected the override to be exported, got: %s", out)
+	}
+}
+
+func TestRunDirIsUniquePerRun(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: rundir
+  jobs:
+    - name: j
+      steps:
+        - name: s
+          type: command
+          command: echo "DIR={{RUN_DIR}} ID={{PIPEJOB_RUN_ID}}"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	// two runs started within the same second
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		out := captureStdout(func() {
+			if rc := RunWithArgs([]string{yamlPath}); rc != 0 {
+				t.Fatalf("non-zero exit: %d", rc)
+			}
+		})
+		var dir, id string
+		for _, f := range strings.Fields(out) {
+			if v, ok := strings.CutPrefix(f, "DIR="); ok {
+				dir = v
+			} else if v, ok := strings.CutPrefix(f, "ID="); ok {
+				id = v
+			}
+		}
+		if filepath.Base(dir) != "pipejob-"+id {
+			t.Fatalf("expected RUN_DIR to be named after the run id, got %q (id %q)", dir, id)
+		}
+		dirs = append(dirs, dir)
+	}
+	if dirs[0] == dirs[1] {
+		t.Fatalf("expected separate run dirs, both runs used %s", dirs[0])
+	}
+}
+
+func TestBuiltinValuesAreNotTemplates(t *testing.T) {
+	// the sample names its pipeline "{{PIPELINE_NAME}}" and references it
+	// from a variable; the built-in value must not count as a cycle
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{"job-sample.yaml", "--dry-run", "--persist-logs", filepath.Join(t.TempDir(), "logs")})
+	})
+	if rc != 0 || !strings.Contains(out, "docker.io/your-org/{{PIPELINE_NAME}}:latest") {
+		t.Fatalf("expected job-sample.yaml to dry-run, got %d: %s", rc, out)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCallJobReturnsAndGotoJobPermanent(t *testing.T) {
+	tmp := t.TempDir()
+
+	// call_job runs the helper, resumes the caller, then continues in order
+	yaml1 := `pipeline:
+  name: call
+  runs: [main, other]
+  jobs:
+    - name: main
+      steps:
+        - name: s1
+          type: command
+          command: echo "start"
+          when:
+            - contains: "start"
+              action: call_job
+              job: helper
+        - name: s2
+          type: command
+          command: echo "MAIN_RESUMED"
+    - name: other
+      steps:
+        - name: o
+          type: command
+          command: echo "OTHER_RAN"
+    - name: helper
+      manual: true
+      steps:
+        - name: h
+          type: command
+          command: echo "HELPER_RAN"
+`
+	p1 := filepath.Join(tmp, "call.yaml")
+	if err := os.WriteFile(p1, []byte(yaml1), 0644); err != nil {
+		t.Fatalf("write yaml1: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{p1}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	h, m, o := strings.Index(out, "HELPER_RAN"), strings.Index(out, "MAIN_RESUMED"), strings.Index(out, "OTHER_RAN")
+	if h == -1 || m == -1 || o == -1 || !(h < m && m < o) {
+		t.Fatalf("expected HELPER_RAN, MAIN_RESUMED, OTHER_RAN in order, got: %s", out)
+	}
+
+	// goto_job with resume: false never returns to the remaining steps
+	yaml2 := `pipeline:
+  name: transfer
+  jobs:
+    - name: main
+      steps:
+        - name: s1
+          type: command
+          command: echo "start"
+          conditions:
+            - pattern: "start"
+              action: goto_job
+              job: target
+              resume: false
+        - name: s2
+          type: command
+          command: echo "SHOULD_NOT_RUN"
+    - name: target
+      steps:
+        - name: t
+          type: command
+          command: echo "TARGET_RAN"
+`
+	p2 := filepath.Join(tmp, "transfer.yaml")
+	if err := os.WriteFile(p2, []byte(yaml2), 0644); err != nil {
+		t.Fatalf("write yaml2: %v", err)
+	}
+	out = captureStdout(func() {
+		if rc := RunWithArgs([]string{p2}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "TARGET_RAN") || strings.Contains(out, "SHOULD_NOT_RUN") {
+		t.Fatalf("expected a permanent transfer to target, got: %s", out)
+	}
+}
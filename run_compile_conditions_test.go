@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInvalidRegexFailsBeforeAnyCommand(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: badregex
+  jobs:
+    - name: j1
+      steps:
+        - name: first
+          type: command
+          command: echo "FIRST_RAN"
+    - name: j2
+      steps:
+        - name: later
+          type: command
+          command: echo "x"
+          when:
+            - any:
+                - regex: "ok("
+              action: continue
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath, "--persist-logs", filepath.Join(tmp, "logs")})
+	})
+	if rc != 6 {
+		t.Fatalf("expected exit code 6 for an invalid regex, got %d", rc)
+	}
+	if strings.Contains(out, "FIRST_RAN") {
+		t.Fatalf("expected no command to run, got: %s", out)
+	}
+}
+
+func TestConditionPatternWithVariable(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: dynregex
+  variables:
+    WANT: "ready"
+  jobs:
+    - name: j1
+      steps:
+        - name: probe
+          type: command
+          command: echo "status=ready"
+          conditions:
+            - pattern: "status={{WANT}}"
+              action: goto_step
+              step: done
+          else_action: fail
+        - name: skipped
+          type: command
+          command: echo "NOT_EXPECTED"
+        - name: done
+          type: command
+          command: echo "DONE"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", filepath.Join(tmp, "logs")}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "DONE") || strings.Contains(out, "NOT_EXPECTED") {
+		t.Fatalf("expected the interpolated pattern to match, got: %s", out)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFailFastStopsAtFirstFailingCommand(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: failfast
+  version: 2
+  jobs:
+    - name: j1
+      steps:
+        - name: multi
+          type: command
+          commands:
+            - "true"
+            - exit 3
+            - echo "AFTER_FAILURE"
+          when:
+            - exit_code: 3
+              action: continue
+        - name: report
+          type: command
+          command: echo "CODES={{step.exit_codes}}"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", filepath.Join(tmp, "logs")}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if strings.Contains(out, "AFTER_FAILURE") {
+		t.Fatalf("expected fail_fast to skip later commands, got: %s", out)
+	}
+	if !strings.Contains(out, "CODES=0,3") {
+		t.Fatalf("expected per-command exit codes, got: %s", out)
+	}
+}
+
+func TestCommandIndexSelectsExitCode(t *testing.T) {
+	tmp := t.TempDir()
+	// version 1: all commands run; the first one failed but the last passed
+	yaml := `pipeline:
+  name: cmdindex
+  jobs:
+    - name: j1
+      steps:
+        - name: multi
+          type: command
+          commands:
+            - exit 2
+            - echo "SECOND_RAN"
+          when:
+            - exit_code: 2
+              command_index: 0
+              action: goto_step
+              step: matched
+          else_action: fail
+        - name: skipped
+          type: command
+          command: echo "NOT_EXPECTED"
+        - name: matched
+          type: command
+          command: echo "MATCHED_FIRST"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", filepath.Join(tmp, "logs")}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "SECOND_RAN") || !strings.Contains(out, "MATCHED_FIRST") || strings.Contains(out, "NOT_EXPECTED") {
+		t.Fatalf("expected command_index 0 to match the first command, got: %s", out)
+	}
+}
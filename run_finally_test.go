@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFinallyAndPostRunOnFailure(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: cleanup
+  jobs:
+    - name: work
+      steps:
+        - name: start
+          type: command
+          command: echo "STARTED"
+        - name: broken
+          type: command
+          command: sh -c 'exit 3'
+        - name: never
+          type: command
+          command: echo "SHOULD_NOT_RUN"
+      post:
+        - name: stop-container
+          type: command
+          command: echo "POST_RAN"
+  finally:
+    - name: report
+      steps:
+        - name: status
+          type: command
+          command: echo "FINALLY {{PIPEJOB_STATUS}} {{PIPEJOB_EXIT_CODE}}"
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", filepath.Join(tmp, "logs")}); rc != 5 {
+			t.Fatalf("expected exit 5, got %d", rc)
+		}
+	})
+	if strings.Contains(out, "SHOULD_NOT_RUN") {
+		t.Fatalf("expected the run to stop at the failing step, got: %s", out)
+	}
+	post, fin := strings.Index(out, "POST_RAN"), strings.Index(out, "FINALLY failed 5")
+	if post == -1 || fin == -1 || post > fin {
+		t.Fatalf("expected POST_RAN before 'FINALLY failed 5', got: %s", out)
+	}
+}
+
+func TestFinallySeesDrop(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: cleanup-drop
+  jobs:
+    - name: work
+      steps:
+        - name: stop
+          type: command
+          command: echo "STOP"
+          when:
+            - contains: "STOP"
+              action: drop
+  finally:
+    - name: report
+      steps:
+        - name: status
+          type: command
+          command: echo "FINALLY {{PIPEJOB_STATUS}}"
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "FINALLY dropped") {
+		t.Fatalf("expected 'FINALLY dropped' in output, got: %s", out)
+	}
+}
+
+func TestPostOfFinishedJobSeesRunningStatus(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: cleanup-running
+  jobs:
+    - name: work
+      steps:
+        - name: start
+          type: command
+          command: echo "STARTED"
+      post:
+        - name: stop-container
+          type: command
+          command: echo "POST {{PIPEJOB_STATUS}} {{PIPEJOB_EXIT_CODE}}"
+  finally:
+    - name: report
+      steps:
+        - name: status
+          type: command
+          command: echo "FINALLY {{PIPEJOB_STATUS}} {{PIPEJOB_EXIT_CODE}}"
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "POST running 0") || !strings.Contains(out, "FINALLY success 0") {
+		t.Fatalf("expected 'POST running 0' and 'FINALLY success 0', got: %s", out)
+	}
+}
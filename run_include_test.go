@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncludeAndTemplates(t *testing.T) {
+	tmp := t.TempDir()
+	files := map[string]string{
+		"shared/docker.yaml": `templates:
+  steps:
+    check-docker:
+      type: command
+      command: echo "DOCKER OK {{REGISTRY}}"
+      timeout: "30s"
+  jobs:
+    prepare:
+      steps:
+        - name: docker
+          extends: check-docker
+        - name: login
+          type: command
+          command: echo "LOGIN {{REGISTRY}}"
+pipeline:
+  variables:
+    REGISTRY: "docker.io"
+    SHARED: "from-include"
+`,
+		"shared/lint.yaml": `pipeline:
+  jobs:
+    - name: lint
+      steps:
+        - name: run
+          type: command
+          command: echo "SHARED LINT"
+`,
+		"job.yaml": `include:
+  - shared/*.yaml
+pipeline:
+  name: app
+  variables:
+    REGISTRY: "ghcr.io"
+  jobs:
+    - name: prepare
+      extends: prepare
+    - name: lint
+      steps:
+        - name: run
+          type: command
+          command: echo "OWN LINT {{SHARED}}"
+    - name: build
+      steps:
+        - name: docker
+          extends: check-docker
+          command: echo "CUSTOM DOCKER"
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(tmp, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{filepath.Join(tmp, "job.yaml"), "--persist-logs", filepath.Join(tmp, "logs")}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	// included jobs come first; a same-named job replaces them in place
+	want := []string{"OWN LINT from-include", "DOCKER OK ghcr.io", "LOGIN ghcr.io", "CUSTOM DOCKER"}
+	last := -1
+	for _, w := range want {
+		i := strings.Index(out, w)
+		if i < 0 || i < last {
+			t.Fatalf("expected %q in order %v, got: %s", w, want, out)
+		}
+		last = i
+	}
+	if strings.Contains(out, "SHARED LINT") {
+		t.Fatalf("expected the own lint job to replace the included one, got: %s", out)
+	}
+}
+
+func TestIncludeAndExtendsCycles(t *testing.T) {
+	tmp := t.TempDir()
+	files := map[string]string{
+		"a.yaml": "include: [b.yaml]\npipeline:\n  name: a\n",
+		"b.yaml": "include: [a.yaml]\n",
+		"c.yaml": `templates:
+  steps:
+    one:
+      extends: two
+    two:
+      extends: one
+pipeline:
+  name: c
+  jobs:
+    - name: j
+      steps:
+        - name: s
+          extends: one
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if rc := RunWithArgs([]string{filepath.Join(tmp, "a.yaml")}); rc != 2 {
+		t.Fatalf("expected exit code 2 for an include cycle, got %d", rc)
+	}
+	if rc := RunWithArgs([]string{filepath.Join(tmp, "c.yaml")}); rc != 6 {
+		t.Fatalf("expected exit code 6 for an extends cycle, got %d", rc)
+	}
+}
+
+func TestIncludeGlobSkipsFilesBeingLoaded(t *testing.T) {
+	tmp := t.TempDir()
+	files := map[string]string{
+		"main.yaml": `include: ["*.yaml"]
+pipeline:
+  name: main
+  jobs:
+    - name: own
+      steps:
+        - name: s
+          type: command
+          command: echo "OWN_RAN"
+`,
+		// matches main.yaml again through its own glob
+		"shared.yaml": `include: ["*.yaml"]
+pipeline:
+  jobs:
+    - name: shared
+      steps:
+        - name: s
+          type: command
+          command: echo "SHARED_RAN"
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{filepath.Join(tmp, "main.yaml"), "--persist-logs", filepath.Join(tmp, "logs")})
+	})
+	if rc != 0 || !strings.Contains(out, "SHARED_RAN") || !strings.Contains(out, "OWN_RAN") {
+		t.Fatalf("expected the glob to skip the including file, got %d: %s", rc, out)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStepFieldsAreInterpolated(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: fields
+  variables:
+    STEP_TIMEOUT: "5s"
+    NEXT: "finish"
+    OUT_VAR: "GREETING"
+  jobs:
+    - name: j1
+      steps:
+        - name: slow
+          type: command
+          command: sleep 1
+          timeout: "{{STEP_TIMEOUT}}"
+          on_timeout: goto_step
+          on_timeout_step: "{{NEXT}}"
+        - name: save
+          type: command
+          command: echo hello
+          save_output: "{{OUT_VAR}}"
+        - name: finish
+          type: command
+          command: echo "FINISH {{GREETING}}"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	logs := filepath.Join(tmp, "logs")
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", logs}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "FINISH hello") {
+		t.Fatalf("expected save_output name from a variable, got: %s", out)
+	}
+
+	// a shorter timeout from --var makes the step jump to {{NEXT}}
+	out = captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", logs, "--var", "STEP_TIMEOUT=100ms"}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if strings.Contains(out, "-> echo hello") || !strings.Contains(out, "FINISH") {
+		t.Fatalf("expected the timeout to jump to the finish step, got: %s", out)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJobIfAndManual(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: opt-in
+  variables:
+    DEPLOY: "false"
+  jobs:
+    - name: build
+      steps:
+        - name: b
+          type: command
+          command: echo "BUILD_RAN"
+    - name: deploy
+      if: "{{DEPLOY}} == true"
+      steps:
+        - name: d
+          type: command
+          command: echo "DEPLOY_RAN"
+    - name: rollback
+      manual: true
+      steps:
+        - name: r
+          type: command
+          command: echo "ROLLBACK_RAN"
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+
+	// default run: deploy is skipped by its condition, rollback is manual
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "BUILD_RAN") {
+		t.Fatalf("expected BUILD_RAN in output, got: %s", out)
+	}
+	if strings.Contains(out, "DEPLOY_RAN") || strings.Contains(out, "ROLLBACK_RAN") {
+		t.Fatalf("expected deploy and rollback to be skipped, got: %s", out)
+	}
+
+	// enabling the condition via --var runs deploy
+	out = captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--var", "DEPLOY=true"}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "DEPLOY_RAN") {
+		t.Fatalf("expected DEPLOY_RAN in output, got: %s", out)
+	}
+
+	// --job selects a manual job and nothing else
+	out = captureStdout(func() {
+		if rc := RunWithArgs([]string{"--job", "rollback", yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "ROLLBACK_RAN") || strings.Contains(out, "BUILD_RAN") {
+		t.Fatalf("expected only ROLLBACK_RAN in output, got: %s", out)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobTimeoutContinuesWithNextJob(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: job-timeout
+  jobs:
+    - name: slow
+      timeout: "1s"
+      on_timeout: continue
+      steps:
+        - name: a
+          type: command
+          command: sleep 0.6
+        - name: b
+          type: command
+          command: sleep 5
+        - name: c
+          type: command
+          command: echo "SHOULD_NOT_RUN"
+    - name: next
+      steps:
+        - name: n
+          type: command
+          command: echo "NEXT_RAN"
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	start := time.Now()
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if d := time.Since(start); d > 3*time.Second {
+		t.Fatalf("expected the job budget to stop step b, took %v", d)
+	}
+	if strings.Contains(out, "SHOULD_NOT_RUN") || !strings.Contains(out, "NEXT_RAN") {
+		t.Fatalf("expected the slow job to stop and the next job to run, got: %s", out)
+	}
+}
+
+func TestPipelineTimeoutFailsRun(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: pipeline-timeout
+  timeout: "500ms"
+  jobs:
+    - name: stuck
+      steps:
+        - name: s
+          type: command
+          command: sleep 5
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	start := time.Now()
+	captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", filepath.Join(tmp, "logs")}); rc != 7 {
+			t.Fatalf("expected exit 7, got %d", rc)
+		}
+	})
+	if d := time.Since(start); d > 3*time.Second {
+		t.Fatalf("expected the pipeline timeout to stop the run, took %v", d)
+	}
+}
+
+func TestJobTimeoutCoversCallJobDetour(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: call-timeout
+  runs: [caller, next]
+  jobs:
+    - name: caller
+      timeout: "1s"
+      on_timeout: continue
+      steps:
+        - name: call
+          type: command
+          command: echo "calling"
+          when:
+            - exit_code: 0
+              action: call_job
+              job: slow
+        - name: after
+          type: command
+          command: echo "CALLER_RESUMED"
+    - name: slow
+      steps:
+        - name: s
+          type: command
+          command: sleep 3
+        - name: t
+          type: command
+          command: echo "SLOW_FINISHED"
+    - name: next
+      steps:
+        - name: n
+          type: command
+          command: echo "NEXT_RAN"
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	start := time.Now()
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if d := time.Since(start); d > 2500*time.Millisecond {
+		t.Fatalf("expected the caller's budget to stop the called job, took %v", d)
+	}
+	if strings.Contains(out, "SLOW_FINISHED") || strings.Contains(out, "CALLER_RESUMED") || !strings.Contains(out, "NEXT_RAN") {
+		t.Fatalf("expected the caller to time out during the call and the next job to run, got: %s", out)
+	}
+}
+
+func TestJobTimeoutLeavesPostStepsRunning(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: job-timeout-post
+  jobs:
+    - name: slow
+      timeout: "500ms"
+      on_timeout: continue
+      steps:
+        - name: a
+          type: command
+          command: sleep 2
+      post:
+        - name: cleanup
+          type: command
+          command: echo "CLEANUP_RAN"
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath, "--persist-logs", filepath.Join(tmp, "logs")})
+	})
+	if rc != 0 || !strings.Contains(out, "CLEANUP_RAN") {
+		t.Fatalf("expected the post step to run after the job timed out, got %d: %s", rc, out)
+	}
+}
+
+func TestJobTimeoutJumpNeverResumes(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	for _, action := range []string{"call_job", "goto_job"} {
+		yaml := `pipeline:
+  name: job-timeout-jump
+  jobs:
+    - name: slow
+      timeout: "300ms"
+      on_timeout: ` + action + `
+      on_timeout_job: alert
+      steps:
+        - name: a
+          type: command
+          command: sleep 2
+        - name: b
+          type: command
+          command: echo "SHOULD_NOT_RUN"
+    - name: next
+      steps:
+        - name: n
+          type: command
+          command: echo "NEXT_RAN"
+    - name: alert
+      manual: true
+      steps:
+        - name: page
+          type: command
+          command: echo "ALERTED"
+`
+		if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+			t.Fatalf("write yaml: %v", err)
+		}
+		var rc int
+		out := captureStdout(func() {
+			rc = RunWithArgs([]string{yamlPath, "--persist-logs", filepath.Join(tmp, "logs")})
+		})
+		if rc != 0 || !strings.Contains(out, "ALERTED") || strings.Contains(out, "SHOULD_NOT_RUN") {
+			t.Fatalf("%s: expected the jump without resuming the timed-out job, got %d: %s", action, rc, out)
+		}
+		if action == "call_job" && !strings.Contains(out, "NEXT_RAN") {
+			t.Fatalf("call_job: expected the run to continue after the called job, got: %s", out)
+		}
+	}
+}
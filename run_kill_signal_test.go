@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTimeoutSendsKillSignalBeforeSIGKILL(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: graceful
+  jobs:
+    - name: j1
+      steps:
+        - name: slow
+          type: command
+          command: "trap 'echo CLEANED_UP; exit 0' TERM; sleep 5 & wait"
+          timeout: "500ms"
+          kill_signal: SIGTERM
+          kill_grace: "3s"
+          on_timeout: continue
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	logDir := filepath.Join(tmp, "logs")
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", logDir}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "CLEANED_UP") {
+		t.Fatalf("expected the SIGTERM trap to run, got: %s", out)
+	}
+	logData, err := os.ReadFile(filepath.Join(logDir, "run.log"))
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if !strings.Contains(string(logData), "terminated by SIGTERM") {
+		t.Fatalf("expected the ending signal in run.log, got: %s", logData)
+	}
+}
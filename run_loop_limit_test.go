@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoopProtection(t *testing.T) {
+	tmp := t.TempDir()
+
+	// two steps bouncing between each other hit pipeline.max_jumps
+	yaml1 := `pipeline:
+  name: bounce
+  max_jumps: 5
+  jobs:
+    - name: j1
+      steps:
+        - name: a
+          type: command
+          command: echo "a"
+          else_action: goto_step
+          else_step: b
+        - name: b
+          type: command
+          command: echo "b"
+          else_action: goto_step
+          else_step: a
+`
+	p1 := filepath.Join(tmp, "bounce.yaml")
+	if err := os.WriteFile(p1, []byte(yaml1), 0644); err != nil {
+		t.Fatalf("write yaml1: %v", err)
+	}
+	logDir := filepath.Join(tmp, "logs1")
+	captureStdout(func() {
+		if rc := RunWithArgs([]string{p1, "--persist-logs", logDir}); rc != 8 {
+			t.Fatalf("expected exit 8, got %d", rc)
+		}
+	})
+	logData, err := os.ReadFile(filepath.Join(logDir, "run.log"))
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if !strings.Contains(string(logData), "j1/b -> goto_step a (else_action)") {
+		t.Fatalf("expected jump history in log, got: %s", logData)
+	}
+
+	// only the most recent jumps are kept, numbered from the total
+	p3 := filepath.Join(tmp, "bounce-long.yaml")
+	if err := os.WriteFile(p3, []byte(strings.Replace(yaml1, "max_jumps: 5", "max_jumps: 30", 1)), 0644); err != nil {
+		t.Fatalf("write yaml3: %v", err)
+	}
+	logDir = filepath.Join(tmp, "logs3")
+	captureStdout(func() {
+		if rc := RunWithArgs([]string{p3, "--persist-logs", logDir}); rc != 8 {
+			t.Fatalf("expected exit 8, got %d", rc)
+		}
+	})
+	logData, err = os.ReadFile(filepath.Join(logDir, "run.log"))
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if !strings.Contains(string(logData), "jump history (last 20 of 31):") || !strings.Contains(string(logData), "  #31 ") || strings.Contains(string(logData), "  #11 ") {
+		t.Fatalf("expected the last 20 of 31 jumps in the history, got: %s", logData)
+	}
+
+	// a retry step capped with max_visits
+	yaml2 := `pipeline:
+  name: retry
+  jobs:
+    - name: j1
+      steps:
+        - name: retry
+          type: command
+          command: echo "NOT_READY"
+          max_visits: 3
+          when:
+            - contains: "NOT_READY"
+              action: goto_step
+              step: retry
+`
+	p2 := filepath.Join(tmp, "retry.yaml")
+	if err := os.WriteFile(p2, []byte(yaml2), 0644); err != nil {
+		t.Fatalf("write yaml2: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{p2, "--persist-logs", filepath.Join(tmp, "logs2")}); rc != 8 {
+			t.Fatalf("expected exit 8, got %d", rc)
+		}
+	})
+	if n := strings.Count(out, "-> echo"); n != 3 {
+		t.Fatalf("expected the retry step to run 3 times, ran %d: %s", n, out)
+	}
+}
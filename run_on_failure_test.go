@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOnFailureRunsRollbackJob(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: on-failure
+  on_failure: rollback
+  jobs:
+    - name: deploy
+      steps:
+        - name: push
+          type: command
+          command: sh -c 'echo "push denied"; exit 1'
+          when:
+            - exit_code: 1
+              action: fail
+    - name: rollback
+      manual: true
+      steps:
+        - name: undo
+          type: command
+          command: echo "ROLLBACK {{FAILED_JOB}}/{{FAILED_STEP}} rc={{EXIT_CODE}} out={{FAILED_OUTPUT}}"
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", filepath.Join(tmp, "logs")}); rc != 7 {
+			t.Fatalf("expected exit 7, got %d", rc)
+		}
+	})
+	if !strings.Contains(out, "ROLLBACK deploy/push rc=7 out=push denied") {
+		t.Fatalf("expected rollback with failure details, got: %s", out)
+	}
+
+	// a successful run never triggers on_failure
+	ok := strings.Replace(yaml, `sh -c 'echo "push denied"; exit 1'`, `echo pushed`, 1)
+	if err := os.WriteFile(yamlPath, []byte(ok), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out = captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if strings.Contains(out, "ROLLBACK") {
+		t.Fatalf("expected no rollback on success, got: %s", out)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const paramsYAML = `pipeline:
+  name: release
+  params:
+    - name: ENV
+      type: enum
+      values: [staging, production]
+      required: true
+      description: Target environment
+    - name: REPLICAS
+      type: int
+      default: 2
+    - name: DRY
+      type: bool
+      default: "no"
+    - name: WAIT
+      type: duration
+      default: 30s
+  variables:
+    TAG: "latest"
+  jobs:
+    - name: deploy
+      steps:
+        - name: show
+          type: command
+          command: echo "DEPLOY {{ENV}} x{{REPLICAS}} dry={{DRY}} wait={{WAIT}} tag={{TAG}}"
+`
+
+func TestParamsValidation(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(paramsYAML), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--var", "ENV=staging", "--var", "DRY=yes", "--var", "TAG=v1"}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "DEPLOY staging x2 dry=true wait=30s tag=v1") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	bad := [][]string{
+		{},                    // ENV is required
+		{"--var", "ENV=prod"}, // not an enum value
+		{"--var", "ENV=staging", "--var", "REPLICAS=two"},
+		{"--var", "ENV=staging", "--var", "WAIT=soon"},
+		{"--var", "ENV=staging", "--var", "REPLICA=3"}, // typo
+	}
+	for _, extra := range bad {
+		var rc int
+		out := captureStdout(func() {
+			rc = RunWithArgs(append([]string{yamlPath}, extra...))
+		})
+		if rc != 2 || strings.Contains(out, "DEPLOY") {
+			t.Errorf("args %v: expected exit code 2 before any command, got %d: %s", extra, rc, out)
+		}
+	}
+}
+
+func TestHelpListsParams(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(paramsYAML), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{"--help", yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	for _, want := range []string{
+		"Params of pipeline release",
+		"ENV                  enum: staging|production (required)",
+		"Target environment",
+		`REPLICAS             int (default: "2")`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in help:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLiveExecutionModeIsRefused(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `execution:
+  mode: live
+pipeline:
+  name: live
+  jobs:
+    - name: j1
+      steps:
+        - name: s1
+          type: command
+          command: echo "RAN"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath})
+	})
+	if rc != 3 || strings.Contains(out, "RAN") {
+		t.Fatalf("expected exit code 3 for execution.mode=live, got %d: %s", rc, out)
+	}
+
+	// a policy file can allow it
+	policyPath := filepath.Join(tmp, "policy.yaml")
+	if err := os.WriteFile(policyPath, []byte("denied_execution_modes: []\n"), 0644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath, "--policy", policyPath, "--persist-logs", filepath.Join(tmp, "logs")})
+	})
+	if rc != 0 {
+		t.Fatalf("expected the policy to allow live mode, got %d", rc)
+	}
+}
+
+func TestPolicyFile(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: guarded
+  variables:
+    TARGET: "/tmp/scratch"
+  jobs:
+    - name: build
+      steps:
+        - name: compile
+          type: command
+          command: echo "BUILD"
+        - name: key
+          type: command
+          command: echo "ACCESS"
+          save_output: KEY
+        - name: pick
+          type: command
+          command: echo "/"
+          save_output: TARGET
+    - name: clean
+      steps:
+        - name: wipe
+          type: command
+          command: "echo rm -rf {{TARGET}}"
+    - name: deploy-prod
+      if: "{{DEPLOY}} == yes"
+      steps:
+        - name: push
+          type: command
+          command: echo "DEPLOYED"
+`
+	policy := `denied_commands:
+  - 'rm -rf /$'
+allowed_shells: [sh]
+confirm_jobs: ["deploy-*"]
+forbidden_variables: ["AWS_*"]
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	// picked up next to the pipeline file
+	if err := os.WriteFile(filepath.Join(tmp, ".pipejob-policy.yaml"), []byte(policy), 0644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	logs := filepath.Join(tmp, "logs")
+	run := func(extra ...string) (int, string) {
+		var rc int
+		out := captureStdout(func() {
+			rc = RunWithArgs(append([]string{yamlPath, "--persist-logs", logs}, extra...))
+		})
+		return rc, out
+	}
+
+	// during execution: the saved output turns the command into a denied one
+	rc, out := run()
+	if rc != 3 || !strings.Contains(out, "BUILD") || strings.Contains(out, "-> echo rm -rf") {
+		t.Fatalf("expected the denied command to be stopped at runtime, got %d: %s", rc, out)
+	}
+
+	// before execution: forbidden variables, shells and unconfirmed jobs
+	for _, extra := range [][]string{
+		{"--var", "AWS_SECRET_ACCESS_KEY=x"},
+		{"--shell", "powershell"},
+		{"--job", "deploy-prod", "--var", "DEPLOY=yes"},
+	} {
+		rc, out := run(extra...)
+		if rc != 3 || strings.Contains(out, "BUILD") || strings.Contains(out, "DEPLOYED") {
+			t.Errorf("args %v: expected exit code 3 before any command, got %d: %s", extra, rc, out)
+		}
+	}
+
+	rc, out = run("--job", "deploy-prod", "--var", "DEPLOY=yes", "--confirm")
+	if rc != 0 || !strings.Contains(out, "DEPLOYED") {
+		t.Fatalf("expected a confirmed job to run, got %d: %s", rc, out)
+	}
+}
+
+func TestPolicyConfirmCoversCleanupJobs(t *testing.T) {
+	tmp := t.TempDir()
+	policyPath := filepath.Join(tmp, "policy.yaml")
+	if err := os.WriteFile(policyPath, []byte("confirm_jobs: [rollback, \"notify-*\"]\n"), 0644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	onFailure := `pipeline:
+  name: rollback
+  on_failure: rollback
+  jobs:
+    - name: deploy
+      steps:
+        - name: push
+          type: command
+          command: echo "WORK" && exit 1
+    - name: rollback
+      manual: true
+      steps:
+        - name: undo
+          type: command
+          command: echo "ROLLED_BACK"
+`
+	finally := `pipeline:
+  name: notify
+  jobs:
+    - name: build
+      steps:
+        - name: compile
+          type: command
+          command: echo "WORK"
+  finally:
+    - name: notify-prod
+      if: "{{NOTIFY}} == yes"
+      steps:
+        - name: send
+          type: command
+          command: echo "NOTIFIED"
+`
+	run := func(yaml string, extra ...string) (int, string) {
+		yamlPath := filepath.Join(tmp, "job.yaml")
+		if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+			t.Fatalf("write yaml: %v", err)
+		}
+		var rc int
+		out := captureStdout(func() {
+			rc = RunWithArgs(append([]string{yamlPath, "--policy", policyPath, "--persist-logs", filepath.Join(tmp, "logs")}, extra...))
+		})
+		return rc, out
+	}
+
+	// the on_failure job is refused before anything runs
+	if rc, out := run(onFailure); rc != 3 || strings.Contains(out, "WORK") || strings.Contains(out, "ROLLED_BACK") {
+		t.Fatalf("expected an unconfirmed on_failure job to be refused up front, got %d: %s", rc, out)
+	}
+	if rc, out := run(onFailure, "--confirm"); rc != 5 || !strings.Contains(out, "ROLLED_BACK") {
+		t.Fatalf("expected a confirmed on_failure job to run, got %d: %s", rc, out)
+	}
+
+	// an if-gated finally job is checked when it is reached
+	if rc, out := run(finally, "--var", "NOTIFY=yes"); rc != 3 || !strings.Contains(out, "WORK") || strings.Contains(out, "NOTIFIED") {
+		t.Fatalf("expected the unconfirmed finally job to be skipped with exit code 3, got %d: %s", rc, out)
+	}
+	if rc, out := run(finally, "--var", "NOTIFY=yes", "--confirm"); rc != 0 || !strings.Contains(out, "NOTIFIED") {
+		t.Fatalf("expected a confirmed finally job to run, got %d: %s", rc, out)
+	}
+}
+
+func TestPolicyForbiddenVariablesCoverProfileEnvAndSavedOutput(t *testing.T) {
+	tmp := t.TempDir()
+	policyPath := filepath.Join(tmp, "policy.yaml")
+	if err := os.WriteFile(policyPath, []byte("forbidden_variables: [\"AWS_*\"]\n"), 0644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	yaml := `pipeline:
+  name: forbidden
+  profiles:
+    dev:
+      env:
+        AWS_SECRET_ACCESS_KEY: x
+  jobs:
+    - name: build
+      steps:
+        - name: compile
+          type: command
+          command: echo "BUILD"
+        - name: key
+          type: command
+          command: echo "ACCESS"
+          save_output: KEY
+        - name: pick
+          type: command
+          command: echo "secret"
+          save_output: "AWS_{{KEY}}"
+        - name: after
+          type: command
+          command: echo "AFTER"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	run := func(extra ...string) (int, string) {
+		var rc int
+		out := captureStdout(func() {
+			rc = RunWithArgs(append([]string{yamlPath, "--policy", policyPath, "--persist-logs", filepath.Join(tmp, "logs")}, extra...))
+		})
+		return rc, out
+	}
+
+	// profile env entries are refused before anything runs
+	if rc, out := run("--profile", "dev"); rc != 3 || strings.Contains(out, "BUILD") {
+		t.Fatalf("expected the profile env entry to be refused up front, got %d: %s", rc, out)
+	}
+	// a save_output name known up front is refused before anything runs
+	if rc, out := run("--var", "KEY=ID"); rc != 3 || strings.Contains(out, "BUILD") {
+		t.Fatalf("expected the save_output name to be refused up front, got %d: %s", rc, out)
+	}
+	// one only known at runtime is refused when it is set
+	if rc, out := run(); rc != 3 || !strings.Contains(out, "BUILD") || strings.Contains(out, "AFTER") {
+		t.Fatalf("expected the saved output to be refused at runtime, got %d: %s", rc, out)
+	}
+}
+
+func TestPolicyDeniedCommandsCoverSecretHelpers(t *testing.T) {
+	tmp := t.TempDir()
+	policyPath := filepath.Join(tmp, "policy.yaml")
+	if err := os.WriteFile(policyPath, []byte("denied_commands: ['wipe\\s+/(\\s|$)']\n"), 0644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	yaml := `pipeline:
+  name: secret-helper
+  secrets:
+    - name: TOKEN
+      command: "echo wipe {{TARGET}} >/dev/null; echo s3cr3t"
+  jobs:
+    - name: build
+      steps:
+        - name: pick
+          type: command
+          command: echo "/"
+          save_output: TARGET
+        - name: use
+          type: command
+          command: echo "USING {{TOKEN}}"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	run := func(extra ...string) (int, string) {
+		var rc int
+		out := captureStdout(func() {
+			rc = RunWithArgs(append([]string{yamlPath, "--policy", policyPath, "--persist-logs", filepath.Join(tmp, "logs")}, extra...))
+		})
+		return rc, out
+	}
+
+	// a helper that can be interpolated up front is refused before anything runs
+	if rc, out := run("--var", "TARGET=/"); rc != 3 || strings.Contains(out, "USING") {
+		t.Fatalf("expected the secret helper to be refused up front, got %d: %s", rc, out)
+	}
+	// one built from saved output is refused before the helper starts
+	if rc, out := run(); rc != 3 || strings.Contains(out, "USING") {
+		t.Fatalf("expected the secret helper to be refused at runtime, got %d: %s", rc, out)
+	}
+}
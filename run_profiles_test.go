@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: profiles
+  variables:
+    TARGET: "local"
+  profiles:
+    staging:
+      variables:
+        TARGET: "staging.example.com"
+      env:
+        DEPLOY_URL: "https://{{TARGET}}"
+    prod:
+      protected: true
+      variables:
+        TARGET: "example.com"
+      jobs: [deploy]
+  jobs:
+    - name: test
+      steps:
+        - name: unit
+          type: command
+          command: echo "TESTS"
+    - name: deploy
+      steps:
+        - name: push
+          type: command
+          command: echo "DEPLOY {{TARGET}} $DEPLOY_URL"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	logs := filepath.Join(tmp, "logs")
+
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", logs, "--profile", "staging"}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "TESTS") || !strings.Contains(out, "DEPLOY staging.example.com https://staging.example.com") {
+		t.Fatalf("expected staging variables and env, got: %s", out)
+	}
+
+	// protected: refused without --confirm
+	var rc int
+	out = captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath, "--persist-logs", logs, "--profile", "prod"})
+	})
+	if rc != 3 || strings.Contains(out, "DEPLOY") {
+		t.Fatalf("expected exit code 3 for a protected profile, got %d: %s", rc, out)
+	}
+
+	out = captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", logs, "--profile", "prod", "--confirm"}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if strings.Contains(out, "TESTS") || !strings.Contains(out, "DEPLOY example.com") {
+		t.Fatalf("expected only the prod jobs with prod variables, got: %s", out)
+	}
+
+	if rc := RunWithArgs([]string{yamlPath, "--profile", "qa"}); rc != 2 {
+		t.Fatalf("expected exit code 2 for an unknown profile, got %d", rc)
+	}
+}
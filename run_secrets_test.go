@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretsAreMasked(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: secrets
+  secrets: [REGISTRY_TOKEN]
+  jobs:
+    - name: push
+      steps:
+        - name: login
+          type: command
+          command: "echo login --password {{REGISTRY_TOKEN}}; exit 1"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	logDir := filepath.Join(tmp, "logs")
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{yamlPath, "--var", "REGISTRY_TOKEN=s3cr3t-value", "--persist-logs", logDir})
+	})
+	if rc != 5 {
+		t.Fatalf("expected exit code 5, got %d", rc)
+	}
+	if strings.Contains(out, "s3cr3t-value") || !strings.Contains(out, "--password ***") {
+		t.Fatalf("expected the token to be masked on stdout, got: %s", out)
+	}
+	data, err := os.ReadFile(filepath.Join(logDir, "run.log"))
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if strings.Contains(string(data), "s3cr3t-value") || !strings.Contains(string(data), "--password ***") {
+		t.Fatalf("expected the token to be masked in run.log, got: %s", data)
+	}
+}
+
+func TestSecretProvidersAreLoadedLazily(t *testing.T) {
+	tmp := t.TempDir()
+	tokenFile := filepath.Join(tmp, "token")
+	if err := os.WriteFile(tokenFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	marker := filepath.Join(tmp, "helper-ran")
+	yaml := `pipeline:
+  name: providers
+  secrets:
+    - name: FILE_TOKEN
+      file: ` + tokenFile + `
+    - name: CMD_TOKEN
+      command: "touch ` + marker + `; echo cmd-secret"
+    - name: UNUSED
+      command: "exit 1"
+  jobs:
+    - name: j1
+      steps:
+        - name: use
+          type: command
+          command: "test {{FILE_TOKEN}} = file-secret && test {{CMD_TOKEN}} = cmd-secret && echo BOTH_OK {{CMD_TOKEN}}"
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+
+	// dry run: the helper command must not run and values are not shown
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--dry-run"}); rc != 0 {
+			t.Fatalf("dry run: non-zero exit: %d", rc)
+		}
+	})
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("expected the helper command not to run in dry-run")
+	}
+	if !strings.Contains(out, "test *** = file-secret && test *** = cmd-secret") {
+		t.Fatalf("expected masked placeholders in dry-run output, got: %s", out)
+	}
+
+	// the unused failing helper is never called
+	out = captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "BOTH_OK ***") || strings.Contains(out, "cmd-secret\n") {
+		t.Fatalf("expected both secrets resolved and masked, got: %s", out)
+	}
+}
+
+func TestSecretsUsedThroughOtherVariables(t *testing.T) {
+	tmp := t.TempDir()
+	tokenFile := filepath.Join(tmp, "token")
+	if err := os.WriteFile(tokenFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	yaml := `pipeline:
+  name: dependent
+  secrets:
+    - name: TOKEN
+      file: ` + tokenFile + `
+  variables:
+    AUTH: "Bearer {{TOKEN}}"
+    HEADER: "Authorization: {{AUTH}}"
+  profiles:
+    dev:
+      env:
+        API_TOKEN: "{{TOKEN}}"
+  jobs:
+    - name: j1
+      if: "{{TOKEN}} == file-secret"
+      steps:
+        - name: use
+          type: command
+          command: >-
+            test "{{HEADER}}" = "Authorization: Bearer file-secret" && test "$API_TOKEN" = file-secret && echo DEP_OK
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--profile", "dev"}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "DEP_OK") || !strings.Contains(out, `test "Authorization: Bearer ***" =`) {
+		t.Fatalf("expected the secret resolved through AUTH and HEADER and masked, got: %s", out)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalForwardedAndCleanupRuns(t *testing.T) {
+	tmp := t.TempDir()
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	yaml := `pipeline:
+  name: interrupt
+  jobs:
+    - name: long
+      steps:
+        - name: wait
+          type: command
+          command: sleep 30
+        - name: never
+          type: command
+          command: echo "SHOULD_NOT_RUN"
+  finally:
+    - name: report
+      steps:
+        - name: status
+          type: command
+          command: echo "FINALLY {{PIPEJOB_STATUS}}"
+`
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	logDir := filepath.Join(tmp, "logs")
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+	start := time.Now()
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath, "--persist-logs", logDir}); rc != 130 {
+			t.Fatalf("expected exit 130, got %d", rc)
+		}
+	})
+	if time.Since(start) > 10*time.Second {
+		t.Fatalf("expected the running command to be interrupted, took %v", time.Since(start))
+	}
+	if strings.Contains(out, "SHOULD_NOT_RUN") || !strings.Contains(out, "FINALLY interrupted") {
+		t.Fatalf("expected the run to stop and cleanup to run, got: %s", out)
+	}
+	logData, err := os.ReadFile(filepath.Join(logDir, "run.log"))
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if !strings.Contains(string(logData), "interrupted by signal") {
+		t.Fatalf("expected the interruption in run.log, got: %s", logData)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStepTimeoutIsCumulativeAcrossCommands(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: cumulative
+  jobs:
+    - name: j1
+      steps:
+        - name: multi
+          type: command
+          commands:
+            - sleep 0.4
+            - sleep 0.4
+            - sleep 0.4
+            - echo "LAST_COMMAND_RAN"
+          timeout: "1s"
+          on_timeout: continue
+`
+	yamlPath := filepath.Join(tmp, "job.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if strings.Contains(out, "LAST_COMMAND_RAN") {
+		t.Fatalf("expected the step deadline to stop the sequence, got: %s", out)
+	}
+
+	// timeout_per_command gives every command the full timeout
+	perCmd := strings.Replace(yaml, `timeout: "1s"`, "timeout: \"1s\"\n          timeout_per_command: true", 1)
+	if err := os.WriteFile(yamlPath, []byte(perCmd), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	out = captureStdout(func() {
+		if rc := RunWithArgs([]string{yamlPath}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "LAST_COMMAND_RAN") {
+		t.Fatalf("expected all commands to run with timeout_per_command, got: %s", out)
+	}
+}
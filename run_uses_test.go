@@ -0,0 +1,244 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const dockerBuildAction = `name: docker-build
+description: Build an image and report its reference
+inputs:
+  - name: IMAGE
+    required: true
+  - name: TAG
+    default: latest
+  - name: RETRIES
+    type: int
+    default: 1
+steps:
+  - name: build
+    type: command
+    command: echo "built {{inputs.IMAGE}}:{{inputs.TAG}} from {{CONTEXT}}"
+    save_output: BUILT
+    when:
+      - contains: "never"
+        action: goto_step
+        step: build
+  - name: inspect
+    type: command
+    command: echo "{{BUILT}} \{{literal}}"
+    save_output: REF
+outputs:
+  ref: "{{REF}}"
+`
+
+func TestUsesLocalAction(t *testing.T) {
+	tmp := t.TempDir()
+	os.MkdirAll(filepath.Join(tmp, "actions", "docker-build"), 0755)
+	files := map[string]string{
+		"actions/docker-build/action.yaml": dockerBuildAction,
+		"job.yaml": `pipeline:
+  name: app
+  variables:
+    CONTEXT: "./src"
+    BUILT: "pipeline-value"
+  jobs:
+    - name: build
+      steps:
+        - name: api
+          uses: ./actions/docker-build
+          with:
+            IMAGE: "acme/api"
+        - name: web
+          uses: ./actions/docker-build
+          with:
+            IMAGE: "acme/web"
+            TAG: "{{CONTEXT}}-v2"
+        - name: report
+          type: command
+          command: echo "API={{api.outputs.ref}} WEB={{web.outputs.ref}} BUILT={{BUILT}}"
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	out := captureStdout(func() {
+		if rc := RunWithArgs([]string{filepath.Join(tmp, "job.yaml")}); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	for _, want := range []string{
+		"built acme/api:latest from ./src",
+		"built acme/web:./src-v2 from ./src",
+		"API=built acme/api:latest from ./src {{literal}} WEB=built acme/web:./src-v2 from ./src {{literal}} BUILT=pipeline-value",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output, got: %s", want, out)
+		}
+	}
+}
+
+func TestUsesErrors(t *testing.T) {
+	tmp := t.TempDir()
+	os.MkdirAll(filepath.Join(tmp, "actions", "docker-build"), 0755)
+	os.MkdirAll(filepath.Join(tmp, "actions", "loop"), 0755)
+	files := map[string]string{
+		"actions/docker-build/action.yaml": dockerBuildAction,
+		"actions/loop/action.yaml": `steps:
+  - name: again
+    uses: ../loop
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	cases := map[string]string{
+		"missing required input": `uses: ./actions/docker-build`,
+		"unknown input":          "uses: ./actions/docker-build\n          with: {IMAGE: x, TGA: v1}",
+		"invalid input type":     "uses: ./actions/docker-build\n          with: {IMAGE: x, RETRIES: many}",
+		"missing action":         `uses: ./actions/nope`,
+		"action cycle":           `uses: ./actions/loop`,
+		"timeout on a uses step": "uses: ./actions/docker-build\n          with: {IMAGE: x}\n          timeout: 1s",
+		"when on a uses step":    "uses: ./actions/docker-build\n          with: {IMAGE: x}\n          when: [{exit_code: 3, action: continue}]",
+	}
+	for name, step := range cases {
+		yamlPath := filepath.Join(tmp, "job.yaml")
+		content := "pipeline:\n  name: app\n  jobs:\n    - name: build\n      steps:\n        - name: img\n          " + step + "\n"
+		if err := os.WriteFile(yamlPath, []byte(content), 0644); err != nil {
+			t.Fatalf("write yaml: %v", err)
+		}
+		if rc := RunWithArgs([]string{yamlPath}); rc != 6 {
+			t.Fatalf("%s: expected exit code 6, got %d", name, rc)
+		}
+	}
+}
+
+func TestUsesStepAsGotoTarget(t *testing.T) {
+	tmp := t.TempDir()
+	os.MkdirAll(filepath.Join(tmp, "actions", "counter"), 0755)
+	files := map[string]string{
+		"actions/counter/action.yaml": `inputs:
+  - name: FILE
+    required: true
+steps:
+  - name: inc
+    type: command
+    command: echo x >> {{inputs.FILE}} && wc -l < {{inputs.FILE}} | tr -d ' '
+    save_output: N
+outputs:
+  count: "{{N}}"
+`,
+		"job.yaml": `pipeline:
+  name: retry
+  jobs:
+    - name: build
+      steps:
+        - name: bump
+          uses: ./actions/counter
+          with:
+            FILE: "{{COUNT_FILE}}"
+        - name: check
+          type: command
+          command: test {{bump.outputs.count}} -ge 3 && echo "DONE {{bump.outputs.count}}" || echo "again"
+          when:
+            - contains: "again"
+              action: goto_step
+              step: bump
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{filepath.Join(tmp, "job.yaml"), "--var", "COUNT_FILE=" + filepath.Join(tmp, "count"), "--persist-logs", filepath.Join(tmp, "logs")})
+	})
+	if rc != 0 || !strings.Contains(out, "DONE 3") {
+		t.Fatalf("expected goto_step to a uses step to retry the action, got %d: %s", rc, out)
+	}
+}
+
+func TestUsesOutputsAfterCommandlessLastStep(t *testing.T) {
+	tmp := t.TempDir()
+	os.MkdirAll(filepath.Join(tmp, "actions", "version"), 0755)
+	files := map[string]string{
+		"actions/version/action.yaml": `steps:
+  - name: read
+    type: command
+    command: echo "1.2.3"
+    save_output: VERSION
+  - name: done
+    type: command
+outputs:
+  version: "{{VERSION}}"
+`,
+		"job.yaml": `pipeline:
+  name: app
+  jobs:
+    - name: build
+      steps:
+        - name: ver
+          uses: ./actions/version
+        - name: report
+          type: command
+          command: echo "VERSION=[{{ver.outputs.version}}]"
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	var rc int
+	out := captureStdout(func() {
+		rc = RunWithArgs([]string{filepath.Join(tmp, "job.yaml"), "--persist-logs", filepath.Join(tmp, "logs")})
+	})
+	if rc != 0 || !strings.Contains(out, "VERSION=[1.2.3]") {
+		t.Fatalf("expected the outputs to be set after a command-less last step, got %d: %s", rc, out)
+	}
+}
+
+func TestUsesInputsCheckedAtRuntime(t *testing.T) {
+	tmp := t.TempDir()
+	os.MkdirAll(filepath.Join(tmp, "actions", "docker-build"), 0755)
+	files := map[string]string{
+		"actions/docker-build/action.yaml": dockerBuildAction,
+		"job.yaml": `pipeline:
+  name: app
+  jobs:
+    - name: build
+      steps:
+        - name: img
+          uses: ./actions/docker-build
+          with:
+            IMAGE: "acme/api"
+            RETRIES: "{{RETRIES}}"
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	run := func(retries string) (int, string) {
+		var rc int
+		out := captureStdout(func() {
+			rc = RunWithArgs([]string{filepath.Join(tmp, "job.yaml"), "--var", "RETRIES=" + retries, "--persist-logs", filepath.Join(tmp, "logs")})
+		})
+		return rc, out
+	}
+	if rc, out := run("abc"); rc != 6 || strings.Contains(out, "built acme/api") {
+		t.Fatalf("expected an invalid int input to stop the action before it runs, got %d: %s", rc, out)
+	}
+	if rc, out := run("3"); rc != 0 || !strings.Contains(out, "built acme/api") {
+		t.Fatalf("expected a valid int input to run the action, got %d: %s", rc, out)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVariableSourcesPrecedence(t *testing.T) {
+	tmp := t.TempDir()
+	yaml := `pipeline:
+  name: sources
+  secrets: [TOKEN]
+  variables:
+    A: "pipeline"
+    B: "pipeline"
+    C: "pipeline"
+    D: "pipeline"
+    E: "pipeline"
+  jobs:
+    - name: j1
+      steps:
+        - name: show
+          type: command
+          command: echo "A={{A}} B={{B}} C={{C}} D={{D}} E={{E}}"
+`
+	files := map[string]string{
+		"job.yaml":    yaml,
+		"vars.yaml":   "B: from-yaml\nC: from-yaml\nN: 3\n",
+		"vars.json":   `{"C": "from-json", "D": "from-json"}`,
+		"first.env":   "D=from-env1\nE=from-env1\nTOKEN=hunter2\n",
+		"second.env":  "E=from-env2\n",
+		"nested.yaml": "X:\n  y: 1\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	args := []string{filepath.Join(tmp, "job.yaml"),
+		"--vars-file", filepath.Join(tmp, "vars.yaml"), "--vars-file", filepath.Join(tmp, "vars.json"),
+		"--env-file", filepath.Join(tmp, "first.env"), "--env-file", filepath.Join(tmp, "second.env"),
+		"--var", "A=cli"}
+
+	out := captureStdout(func() {
+		if rc := RunWithArgs(args); rc != 0 {
+			t.Fatalf("non-zero exit: %d", rc)
+		}
+	})
+	if !strings.Contains(out, "A=cli B=from-yaml C=from-json D=from-env1 E=from-env2") {
+		t.Fatalf("unexpected precedence, got: %s", out)
+	}
+
+	out = captureStdout(func() {
+		if rc := RunWithArgs(append(args, "--print-vars")); rc != 0 {
+			t.Fatalf("--print-vars: non-zero exit: %d", rc)
+		}
+	})
+	// compare with the column padding collapsed
+	compact := strings.Join(strings.Fields(out), " ")
+	for _, want := range []string{
+		"A = cli (--var)",
+		"C = from-json (vars file " + filepath.Join(tmp, "vars.json") + ")",
+		"E = from-env2 (env file " + filepath.Join(tmp, "second.env") + ")",
+		"N = 3 (vars file",
+		"TOKEN = *** (env file",
+	} {
+		if !strings.Contains(compact, want) {
+			t.Errorf("--print-vars output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "-> echo") {
+		t.Fatalf("--print-vars must mask secrets and not run commands, got: %s", out)
+	}
+
+	if rc := RunWithArgs([]string{args[0], "--vars-file", filepath.Join(tmp, "nested.yaml")}); rc != 2 {
+		t.Fatalf("expected exit code 2 for a nested vars file, got %d", rc)
+	}
+	if rc := RunWithArgs([]string{args[0], "--vars-file", filepath.Join(tmp, "missing.yaml")}); rc != 2 {
+		t.Fatalf("expected exit code 2 for a missing vars file, got %d", rc)
+	}
+}
+
+func TestVarsFileKeepsScalarsAsWritten(t *testing.T) {
+	tmp := t.TempDir()
+	files := map[string]string{
+		"vars.yaml": "TAG: 1.10\nMODE: 0755\nBIG: 1e3\nFLAG: true\nEMPTY: ~\nQUOTED: \"0755\"\n",
+		"vars.json": `{"VERSION": 2.50, "NONE": null}`,
+	}
+	want := map[string]map[string]string{
+		"vars.yaml": {"TAG": "1.10", "MODE": "0755", "BIG": "1e3", "FLAG": "true", "EMPTY": "", "QUOTED": "0755"},
+		"vars.json": {"VERSION": "2.50", "NONE": ""},
+	}
+	for name, content := range files {
+		path := filepath.Join(tmp, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		got, err := loadVarsFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for k, v := range want[name] {
+			if got[k] != v {
+				t.Errorf("%s: %s = %q, want %q", name, k, got[k], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// secretMask replaces secret values in everything pipejob prints or logs.
+const secretMask = "***"
+
+// secretMasker hides the current values of the variables listed in
+// `pipeline.secrets`. Values are looked up on every call so secrets updated
+// later (e.g. via save_output) are masked too.
+type secretMasker struct {
+	names []string
+	vars  map[string]string
+}
+
+// mask returns s with every secret value replaced by ***. Longer values are
+// replaced first so a secret containing another one is fully hidden.
+func (m *secretMasker) mask(s string) string {
+	if m == nil || len(m.names) == 0 || s == "" {
+		return s
+	}
+	values := make([]string, 0, len(m.names))
+	for _, n := range m.names {
+		if v := m.vars[n]; v != "" {
+			values = append(values, v)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, v := range values {
+		s = strings.ReplaceAll(s, v, secretMask)
+	}
+	return s
+}
+
+// secretNames returns the variable names declared in `pipeline.secrets`.
+func secretNames(specs []SecretSpec) []string {
+	names := make([]string, 0, len(specs))
+	for _, s := range specs {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// validateSecrets checks the `secrets` entries before the run starts.
+func validateSecrets(specs []SecretSpec) error {
+	for i, s := range specs {
+		if s.Name == "" {
+			return fmt.Errorf("secrets entry %d has no name", i+1)
+		}
+		if s.File != "" && s.Command != "" {
+			return fmt.Errorf("secret %s: set either file or command, not both", s.Name)
+		}
+	}
+	return nil
+}
+
+// referencesVar reports whether tmpl contains a placeholder for name.
+func referencesVar(tmpl, name string) bool {
+	for _, ref := range placeholderRefs(tmpl) {
+		if ref == name {
+			return true
+		}
+	}
+	return false
+}
+
+// secretRefs returns the pending secrets tmpl needs, following variable
+// references transitively: {{AUTH}} needs TOKEN when AUTH is
+// "Bearer {{TOKEN}}". Variables are resolved before secrets are loaded, so
+// a dependent value still holds the secret's placeholder.
+func secretRefs(tmpl string, vars map[string]string, pending map[string]SecretSpec) []string {
+	var names []string
+	seen := map[string]bool{}
+	var walk func(string)
+	walk = func(s string) {
+		for _, ref := range placeholderRefs(s) {
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			if _, ok := pending[ref]; ok {
+				names = append(names, ref)
+			} else if v, ok := vars[ref]; ok {
+				walk(v)
+			}
+		}
+	}
+	walk(tmpl)
+	return names
+}
+
+// setSecret sets the secret variable name to value and substitutes it in
+// the variables whose values still reference it.
+func setSecret(vars map[string]string, name, value string) {
+	vars[name] = value
+	for k, v := range vars {
+		if k != name && referencesVar(v, name) {
+			vars[k] = rewritePlaceholders(v, func(ref string) (string, bool) {
+				if ref == name {
+					return value, true
+				}
+				return "", false
+			})
+		}
+	}
+}
+
+// loadSecret reads the value of a file or command secret. Trailing newlines
+// are removed, as mounted secret files and helper tools usually add one.
+func loadSecret(s SecretSpec, vars map[string]string) (string, error) {
+	if s.File != "" {
+		b, err := os.ReadFile(interpolate(s.File, vars))
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %v", s.Name, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	var out, errOut bytes.Buffer
+	if _, err := runLocalCommandExec(interpolate(s.Command, vars), commandOptions{}, &out, &errOut); err != nil {
+		msg := strings.TrimSpace(errOut.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("secret %s: command failed: %s", s.Name, msg)
+	}
+	return strings.TrimRight(out.String(), "\r\n"), nil
+}
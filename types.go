@@ -2,37 +2,123 @@ package main
 
 import (
 	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Minimal types matching the sample job YAML. We only support the fields
 // required for local command execution.
 type PipelineFile struct {
-	Pipeline struct {
-		Name      string            `yaml:"name"`
+	// Include lists other pipeline files (paths or globs, relative to this
+	// file) whose jobs, variables and templates are merged into this one.
+	Include []string `yaml:"include,omitempty"`
+	// Templates are named jobs and steps that jobs and steps can `extends`.
+	Templates Templates `yaml:"templates,omitempty"`
+	Pipeline  struct {
+		Name string `yaml:"name"`
+		// Version is the pipeline schema version. Version 2 turns on
+		// fail_fast by default for multi-command steps.
+		Version   int               `yaml:"version,omitempty"`
 		Runs      []string          `yaml:"runs"`
 		Variables map[string]string `yaml:"variables"`
 		Jobs      []Job             `yaml:"jobs"`
+		// MaxJumps limits the number of goto_step/goto_job/call_job jumps
+		// in one run (0 means defaultMaxJumps, negative disables the limit).
+		MaxJumps int `yaml:"max_jumps,omitempty"`
+		// Finally jobs always run before pipejob exits, whatever the
+		// outcome (success, fail, drop, unmatched non-zero exit, timeout).
+		Finally []Job `yaml:"finally,omitempty"`
+		// OnFailure runs when the run is about to exit with a failing code,
+		// before any owed post steps and the finally jobs.
+		OnFailure *OnFailure `yaml:"on_failure,omitempty"`
+		// Timeout bounds the whole run (Go duration). Commands only get the
+		// remaining budget; when it runs out the run fails with exit code 7.
+		Timeout string `yaml:"timeout,omitempty"`
+		// Secrets lists variables whose values are masked as *** in
+		// terminal output and logs. Entries either name an existing variable
+		// or load the value from a file or a helper command.
+		Secrets []SecretSpec `yaml:"secrets,omitempty"`
+		// Params declares typed inputs, validated before the run starts.
+		Params []Param `yaml:"params,omitempty"`
+		// Profiles are named environments selected with --profile.
+		Profiles map[string]Profile `yaml:"profiles,omitempty"`
 	} `yaml:"pipeline"`
+	// Execution describes where the pipeline is meant to run. Modes listed
+	// in the policy's denied_execution_modes (default: live) are refused.
+	Execution struct {
+		Mode string `yaml:"mode,omitempty"`
+	} `yaml:"execution,omitempty"`
 }
 
 type Job struct {
-	Name  string `yaml:"name"`
-	Steps []Step `yaml:"steps"`
+	Name string `yaml:"name"`
+	// Extends names a job template (templates.jobs) this job is based on.
+	// Fields set on the job override the template's.
+	Extends string `yaml:"extends,omitempty"`
+	// If is an optional condition evaluated against the pipeline variables
+	// right before the job's first step. When it evaluates to false the job
+	// is skipped. Supported forms: "A == B", "A != B", "!A" and a bare value
+	// (see evalIfExpr).
+	If string `yaml:"if,omitempty"`
+	// Manual jobs are excluded from the normal run. They only execute when
+	// named explicitly via --job or when reached through goto_job.
+	Manual bool   `yaml:"manual,omitempty"`
+	Steps  []Step `yaml:"steps"`
+	// Post steps run once the job has no more steps to run, including when
+	// the run ends early while the job is active.
+	Post []Step `yaml:"post,omitempty"`
+	// Timeout bounds all steps of the job (Go duration). When the budget
+	// runs out OnTimeout decides what happens: fail (default), continue
+	// (with the next job), drop, goto_job or call_job (target in
+	// OnTimeoutJob; the timed-out job is never resumed).
+	Timeout      string `yaml:"timeout,omitempty"`
+	OnTimeout    string `yaml:"on_timeout,omitempty"`
+	OnTimeoutJob string `yaml:"on_timeout_job,omitempty"`
+
+	// resumeOf is set on generated resume jobs to the name of the job they
+	// continue, so per-step bookkeeping can use the original job name.
+	resumeOf string
+	// deadline is the job's timeout deadline once it started; resume jobs
+	// inherit it so a detour does not reset the budget.
+	deadline time.Time
+	// caller is set on the target of a goto_job/call_job detour to the job
+	// it returns to, whose timeout keeps running during the detour.
+	caller *Job
+}
+
+// baseName returns the declared name of the job, looking through generated
+// resume jobs.
+func (j Job) baseName() string {
+	if j.resumeOf != "" {
+		return j.resumeOf
+	}
+	return j.Name
+}
+
+// budgetJob returns the job whose timeout ends first while j runs: j
+// itself or one of the jobs detoured into it.
+func (j *Job) budgetJob() *Job {
+	b := j
+	for c := j.caller; c != nil; c = c.caller {
+		if !c.deadline.IsZero() && (b.deadline.IsZero() || c.deadline.Before(b.deadline)) {
+			b = c
+		}
+	}
+	return b
 }
 
 type Step struct {
-	Name       string   `yaml:"name"`
-	Type       string   `yaml:"type"`
-	Command    string   `yaml:"command"`
-	Commands   []string `yaml:"commands"`
-	SaveOutput string   `yaml:"save_output"`
-	Silent     bool     `yaml:"silent"`
-	Conditions []struct {
-		Pattern string `yaml:"pattern"`
-		Action  string `yaml:"action"`
-		Step    string `yaml:"step"`
-		Job     string `yaml:"job"`
-	} `yaml:"conditions"`
+	Name string `yaml:"name"`
+	// Extends names a step template (templates.steps) this step is based
+	// on. Fields set on the step override the template's.
+	Extends    string      `yaml:"extends,omitempty"`
+	Type       string      `yaml:"type"`
+	Command    string      `yaml:"command"`
+	Commands   []string    `yaml:"commands"`
+	SaveOutput string      `yaml:"save_output"`
+	Silent     bool        `yaml:"silent"`
+	Conditions []Condition `yaml:"conditions"`
 	// When is a more intuitive condition DSL: simple operators like contains,
 	// equals, regex and exit_code. It is evaluated after the legacy
 	// `conditions` patterns (kept for backward compatibility).
@@ -43,19 +129,190 @@ type Step struct {
 	ElseAction string      `yaml:"else_action"`
 	ElseStep   string      `yaml:"else_step"`
 	ElseJob    string      `yaml:"else_job"`
+	// ElseResume is the `resume` flag for an else goto_job.
+	ElseResume *bool `yaml:"else_resume,omitempty"`
 	// optional timeout for the step, expressed as a Go duration string
 	// (for example: "30s", "1m"). If set, the step's command will be
 	// killed when the timeout is reached and treated as a non-zero exit.
+	// With `commands` the timeout covers the whole sequence: each command
+	// only gets the time that is left.
 	Timeout string `yaml:"timeout"`
+	// TimeoutPerCommand restores the old behavior of giving every command
+	// of `commands` the full `timeout`.
+	TimeoutPerCommand bool `yaml:"timeout_per_command,omitempty"`
+	// FailFast stops a `commands` sequence at the first command returning
+	// non-zero. Defaults to true for pipeline version 2, false before.
+	FailFast *bool `yaml:"fail_fast,omitempty"`
 	// optional idle timeout: maximum duration with no stdout/stderr activity
 	// (for example: "30s", "1m"). If the command produces no output for
 	// this duration the step is killed and treated as a timeout (exit 124).
 	IdleTimeout string `yaml:"idle_timeout"`
+	// kill_signal is sent to the command's process group when it hits its
+	// timeout or idle timeout (for example "SIGTERM"); if it is still running
+	// after kill_grace (Go duration) it is killed with SIGKILL. Without a
+	// kill_signal (here or via --kill-signal) SIGKILL is sent right away.
+	KillSignal string `yaml:"kill_signal,omitempty"`
+	KillGrace  string `yaml:"kill_grace,omitempty"`
 	// on_timeout is a shortcut action applied when the step hits its timeout.
-	// Supported values: continue, drop, goto_step, goto_job, fail
-	OnTimeout     string `yaml:"on_timeout"`
-	OnTimeoutStep string `yaml:"on_timeout_step"`
-	OnTimeoutJob  string `yaml:"on_timeout_job"`
+	// Supported values: continue, drop, goto_step, goto_job, call_job, fail
+	OnTimeout       string `yaml:"on_timeout"`
+	OnTimeoutStep   string `yaml:"on_timeout_step"`
+	OnTimeoutJob    string `yaml:"on_timeout_job"`
+	OnTimeoutResume *bool  `yaml:"on_timeout_resume,omitempty"`
+	// MaxVisits caps how many times this step may run in one pipeline run
+	// (useful for retry loops built with goto_step). 0 means no per-step cap.
+	MaxVisits int `yaml:"max_visits,omitempty"`
+	// Uses names a local action directory (containing action.yaml) whose
+	// steps replace this step at load time; With sets the action's inputs.
+	Uses string            `yaml:"uses,omitempty"`
+	With map[string]string `yaml:"with,omitempty"`
+
+	// exports are the outputs of an expanded action (variable name ->
+	// template), set once this step, the action's last, has run.
+	exports map[string]string
+	// inputChecks are the action inputs whose values are only known at
+	// runtime, checked before this step, the action's first, runs.
+	inputChecks []inputCheck
+}
+
+// Condition is a legacy `conditions` entry: a regex pattern mapped to an
+// action.
+type Condition struct {
+	Pattern string `yaml:"pattern"`
+	Action  string `yaml:"action"`
+	Step    string `yaml:"step"`
+	Job     string `yaml:"job"`
+	// Resume applies to goto_job. By default (nil or true) the jump is a
+	// detour that returns to the remaining steps of the current job; false
+	// makes it a permanent transfer.
+	Resume *bool `yaml:"resume,omitempty"`
+
+	matcher *patternMatcher // compiled Pattern, see compileConditions
+}
+
+// flowAction is a control-flow action taken from a `conditions` entry, a
+// `when` entry, `else_action` or `on_timeout` (of a step or a job),
+// normalized so they all share the same handling (see applyAction in
+// RunWithArgs).
+type flowAction struct {
+	Action string
+	Step   string
+	Job    string
+	Resume *bool
+	// NoResume makes goto_job and call_job permanent transfers regardless
+	// of Resume: a timed-out job is never resumed.
+	NoResume bool
+	// Origin names the source in messages; StepField and JobField name the
+	// YAML keys holding the targets.
+	Origin    string
+	StepField string
+	JobField  string
+}
+
+func (c Condition) flowAction() flowAction {
+	return flowAction{Action: c.Action, Step: c.Step, Job: c.Job, Resume: c.Resume,
+		Origin: "condition", StepField: "step", JobField: "job"}
+}
+
+func (w WhenEntry) flowAction() flowAction {
+	return flowAction{Action: w.Action, Step: w.Step, Job: w.Job, Resume: w.Resume,
+		Origin: "when", StepField: "step", JobField: "job"}
+}
+
+func (s Step) elseFlowAction() flowAction {
+	return flowAction{Action: s.ElseAction, Step: s.ElseStep, Job: s.ElseJob, Resume: s.ElseResume,
+		Origin: "else_action", StepField: "else_step", JobField: "else_job"}
+}
+
+func (s Step) timeoutFlowAction() flowAction {
+	return flowAction{Action: s.OnTimeout, Step: s.OnTimeoutStep, Job: s.OnTimeoutJob, Resume: s.OnTimeoutResume,
+		Origin: "on_timeout", StepField: "on_timeout_step", JobField: "on_timeout_job"}
+}
+
+// timeoutFlowAction is the job-level on_timeout jump (goto_job/call_job).
+func (j Job) timeoutFlowAction() flowAction {
+	return flowAction{Action: j.OnTimeout, Job: j.OnTimeoutJob, NoResume: true,
+		Origin: "job on_timeout", JobField: "on_timeout_job"}
+}
+
+// OnFailure names a declared job, or lists inline steps, to run when the
+// pipeline fails. In YAML it is either a job name (`on_failure: rollback`)
+// or a mapping with `job` and/or `steps`.
+type OnFailure struct {
+	Job   string `yaml:"job,omitempty"`
+	Steps []Step `yaml:"steps,omitempty"`
+}
+
+// UnmarshalYAML accepts the scalar job-name shorthand.
+func (o *OnFailure) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		o.Job = n.Value
+		return nil
+	}
+	type plain OnFailure
+	return n.Decode((*plain)(o))
+}
+
+// Templates holds reusable job and step definitions.
+type Templates struct {
+	Jobs  map[string]Job  `yaml:"jobs,omitempty"`
+	Steps map[string]Step `yaml:"steps,omitempty"`
+}
+
+// Action is a reusable step sequence loaded from the action.yaml of a
+// directory named by a step's `uses`. Inputs are declared like params and
+// referenced as {{inputs.NAME}}; Outputs map output names to templates
+// evaluated after the last step.
+type Action struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description,omitempty"`
+	Inputs      []Param           `yaml:"inputs,omitempty"`
+	Steps       []Step            `yaml:"steps"`
+	Outputs     map[string]string `yaml:"outputs,omitempty"`
+}
+
+// Profile is a named environment (dev, staging, prod, ...) selected with
+// --profile. Its variables override the pipeline variables, Env is added to
+// every command's environment and Jobs, when set, replaces `runs`. A
+// protected profile only runs with --confirm.
+type Profile struct {
+	Description string            `yaml:"description,omitempty"`
+	Variables   map[string]string `yaml:"variables,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty"`
+	Jobs        []string          `yaml:"jobs,omitempty"`
+	Protected   bool              `yaml:"protected,omitempty"`
+}
+
+// Param declares a pipeline parameter: a variable with a type, validated
+// (and set via --var) before any command runs. Type is string (default),
+// int, bool, enum (with Values) or duration.
+type Param struct {
+	Name        string   `yaml:"name"`
+	Type        string   `yaml:"type,omitempty"`
+	Default     *string  `yaml:"default,omitempty"`
+	Required    bool     `yaml:"required,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+	Values      []string `yaml:"values,omitempty"`
+}
+
+// SecretSpec declares a secret variable. In YAML it is either a variable
+// name (`- REGISTRY_TOKEN`) or a mapping with `name` and one of `file` (read
+// the value from a file) or `command` (use the command's stdout). File and
+// command secrets are loaded the first time a step command references them.
+type SecretSpec struct {
+	Name    string `yaml:"name"`
+	File    string `yaml:"file,omitempty"`
+	Command string `yaml:"command,omitempty"`
+}
+
+// UnmarshalYAML accepts the scalar variable-name shorthand.
+func (s *SecretSpec) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		s.Name = n.Value
+		return nil
+	}
+	type plain SecretSpec
+	return n.Decode((*plain)(s))
 }
 
 // WhenEntry represents a single `when` clause which can be a leaf condition
@@ -65,12 +322,19 @@ type WhenEntry struct {
 	Equals   string `yaml:"equals"`
 	Regex    string `yaml:"regex"`
 	ExitCode *int   `yaml:"exit_code"`
-	Action   string `yaml:"action"`
-	Step     string `yaml:"step"`
-	Job      string `yaml:"job"`
+	// CommandIndex selects which command's exit code `exit_code` matches
+	// (0-based, negative counts from the end). Default: the last command.
+	CommandIndex *int   `yaml:"command_index,omitempty"`
+	Action       string `yaml:"action"`
+	Step         string `yaml:"step"`
+	Job          string `yaml:"job"`
+	// Resume applies to goto_job; see Condition.Resume.
+	Resume *bool `yaml:"resume,omitempty"`
 	// Groups
 	All []WhenEntry `yaml:"all"`
 	Any []WhenEntry `yaml:"any"`
+
+	matcher *patternMatcher // compiled Regex, see compileConditions
 }
 
 // helper to parse simple key=val CLI vars
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadVarsFile reads a flat mapping of variables from a YAML or JSON file
+// (JSON is parsed as YAML). Scalar values are taken as written, so `1.10`
+// and `0755` stay as they are (like in pipeline.variables); nested
+// mappings and lists are rejected.
+func loadVarsFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]yaml.Node
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	out := make(map[string]string, len(raw))
+	for k, node := range raw {
+		n := &node
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+		switch {
+		case n.Kind != yaml.ScalarNode:
+			return nil, fmt.Errorf("%s: variable %s must be a scalar value", path, k)
+		case n.Tag == "!!null":
+			out[k] = ""
+		default:
+			out[k] = n.Value
+		}
+	}
+	return out, nil
+}
+
+// printVars writes every variable with its final value and the source that
+// set it, sorted by name. Secret values are masked.
+func printVars(vars map[string]string, sources map[string]string, m *secretMasker) {
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	width := 0
+	for _, k := range names {
+		if len(k) > width {
+			width = len(k)
+		}
+	}
+	for _, k := range names {
+		v := m.mask(vars[k])
+		if strings.ContainsAny(v, "\n") {
+			v = fmt.Sprintf("%q", v)
+		}
+		fmt.Printf("%-*s = %s  (%s)\n", width, k, v, sources[k])
+	}
+}